@@ -0,0 +1,641 @@
+package template
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jocgir/template/parse"
+)
+
+// CheckError describes a problem detected by Check in a template.
+type CheckError struct {
+	Name     string     // Name of the template being checked.
+	Location string     // Location of the faulty node, as returned by ErrorContext.
+	Node     parse.Node // The faulty node.
+	Err      error      // Description of the problem.
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("template: %s: checking %q at <%s>: %v", e.Location, e.Name, e.Node, e.Err)
+}
+
+func (e *CheckError) Unwrap() error { return e.Err }
+
+// CheckErrors is the error returned by Check, it lists all problems found.
+type CheckErrors []*CheckError
+
+func (e CheckErrors) Error() string {
+	messages := make([]string, len(e))
+	for i := range e {
+		messages[i] = e[i].Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Check statically validates the template and its associated templates against the
+// type of data that will be supplied to Execute. It reports:
+//   - fields or methods that do not exist on the type of the value they are applied to
+//   - functions and methods called with the wrong number or the wrong type of arguments
+//   - {{template}} invocations of undefined templates
+//
+// The type of dot is followed through with, range and template invocations. When a
+// type cannot be statically determined (interface{}, reflect.Value, functions using
+// *Context), the expressions depending on it are not checked.
+//
+// Templates that are not invoked from t are checked with dataType as dot.
+// The returned error is nil or a CheckErrors listing all problems.
+func (t *Template) Check(dataType reflect.Type) error {
+	if t.common == nil {
+		return nil
+	}
+	c := &checker{
+		tmpl:     t,
+		visited:  make(map[string]bool),
+		reached:  make(map[string]bool),
+		reported: make(map[string]bool),
+	}
+	c.template(t, dataType)
+	names := make([]string, 0, len(t.tmpl))
+	for name := range t.tmpl {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !c.reached[name] {
+			c.template(t.tmpl[name], dataType)
+		}
+	}
+	if len(c.errors) == 0 {
+		return nil
+	}
+	return c.errors
+}
+
+// missingType indicates the absence of piped value, as missingVal does at execution.
+var missingType = reflect.TypeOf(missingValType{})
+
+// checker holds the state of a static check. A nil reflect.Type stands for a value
+// whose type is only known at execution.
+type checker struct {
+	tmpl     *Template
+	current  *Template
+	layout   *Template // extending template whose blocks override the invoked ones.
+	vars     []checkVariable
+	errors   CheckErrors
+	visited  map[string]bool // templates already checked with a given type of dot.
+	reached  map[string]bool // templates already checked.
+	reported map[string]bool // errors already reported.
+}
+
+// checkVariable holds the static type of a variable such as $, $x etc.
+type checkVariable struct {
+	name string
+	typ  reflect.Type
+}
+
+func (c *checker) errorf(node parse.Node, format string, args ...interface{}) {
+	location, _ := c.current.ErrorContext(node)
+	err := &CheckError{Name: c.current.Name(), Location: location, Node: node, Err: fmt.Errorf(format, args...)}
+	if !c.reported[err.Error()] {
+		c.reported[err.Error()] = true
+		c.errors = append(c.errors, err)
+	}
+}
+
+func (c *checker) mark() int                      { return len(c.vars) }
+func (c *checker) pop(mark int)                   { c.vars = c.vars[:mark] }
+func (c *checker) setTop(n int, typ reflect.Type) { c.vars[len(c.vars)-n].typ = typ }
+
+func (c *checker) push(name string, typ reflect.Type) {
+	c.vars = append(c.vars, checkVariable{name, typ})
+}
+
+func (c *checker) setVar(name string, typ reflect.Type) {
+	for i := c.mark() - 1; i >= 0; i-- {
+		if c.vars[i].name == name {
+			c.vars[i].typ = typ
+			return
+		}
+	}
+}
+
+func (c *checker) varType(name string) reflect.Type {
+	for i := c.mark() - 1; i >= 0; i-- {
+		if c.vars[i].name == name {
+			return c.vars[i].typ
+		}
+	}
+	return nil
+}
+
+// template checks the template with the supplied type of dot.
+func (c *checker) template(tmpl *Template, dot reflect.Type) {
+	if tmpl == nil || tmpl.Tree == nil || tmpl.Root == nil {
+		return
+	}
+	key := fmt.Sprintf("%p\x00%v", tmpl.Tree, dot)
+	if c.visited[key] {
+		return
+	}
+	c.visited[key] = true
+	if c.tmpl.Lookup(tmpl.Name()) == tmpl {
+		c.reached[tmpl.Name()] = true
+	}
+
+	current, vars, layout := c.current, c.vars, c.layout
+	if tmpl.Extends != "" {
+		if base := c.tmpl.Lookup(tmpl.Extends); base == nil || base.Tree == nil {
+			c.current = tmpl
+			c.errorf(tmpl.Root, "template %q extended by %q not defined", tmpl.Extends, tmpl.Name())
+		}
+		c.layout = tmpl
+	}
+	c.current, c.vars = tmpl, []checkVariable{{"$", dot}}
+	for _, param := range tmpl.Params {
+		// The type of the parameters depends on the caller.
+		if param.Value != nil {
+			c.arg(dot, nil, param.Value)
+		}
+		c.push("$"+param.Name, nil)
+	}
+	c.walk(dot, tmpl.Root)
+	c.current, c.vars, c.layout = current, vars, layout
+}
+
+func (c *checker) walk(dot reflect.Type, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ActionNode:
+		c.pipeline(dot, node.Pipe)
+	case *parse.CaptureNode:
+		mark := c.mark()
+		c.walk(dot, node.List)
+		c.pop(mark)
+		c.push(node.Variable.Ident[0], reflect.TypeOf(""))
+	case *parse.IfNode:
+		c.ifOrWith(parse.NodeIf, dot, node.Pipe, node.List, node.ElseList)
+	case *parse.ListNode:
+		for _, node := range node.Nodes {
+			c.walk(dot, node)
+		}
+	case *parse.RangeNode:
+		c.walkRange(dot, node)
+	case *parse.TryNode:
+		mark := c.mark()
+		c.walk(dot, node.List)
+		c.pop(mark)
+		if node.Catch != nil {
+			if node.Variable != nil {
+				c.push(node.Variable.Ident[0], reflect.TypeOf(ExecError{}))
+			}
+			c.walk(dot, node.Catch)
+			c.pop(mark)
+		}
+	case *parse.SwitchNode:
+		mark := c.mark()
+		c.pipeline(dot, node.Pipe)
+		for _, clause := range node.Cases {
+			for _, value := range clause.Values {
+				c.arg(dot, nil, value)
+			}
+			c.walk(dot, clause.List)
+		}
+		if node.Default != nil {
+			c.walk(dot, node.Default)
+		}
+		c.pop(mark)
+	case *parse.TemplateNode:
+		c.walkTemplate(dot, node)
+	case *parse.WithNode:
+		c.ifOrWith(parse.NodeWith, dot, node.Pipe, node.List, node.ElseList)
+	}
+}
+
+func (c *checker) ifOrWith(typ parse.NodeType, dot reflect.Type, pipe *parse.PipeNode, list, elseList *parse.ListNode) {
+	defer c.pop(c.mark())
+	val := c.pipeline(dot, pipe)
+	if typ == parse.NodeWith {
+		c.walk(val, list)
+	} else {
+		c.walk(dot, list)
+	}
+	if elseList != nil {
+		c.walk(dot, elseList)
+	}
+}
+
+func (c *checker) walkRange(dot reflect.Type, r *parse.RangeNode) {
+	defer c.pop(c.mark())
+	val := indirectType(c.pipeline(dot, r.Pipe))
+	var key, elem reflect.Type
+	if val != nil {
+		switch val.Kind() {
+		case reflect.Array, reflect.Slice, reflect.Chan:
+			key, elem = reflect.TypeOf(0), val.Elem()
+		case reflect.Map:
+			key, elem = val.Key(), val.Elem()
+		case reflect.Interface:
+		default:
+			c.errorf(r, "range can't iterate over %s", val)
+		}
+	}
+	first := 1
+	if r.Loop {
+		c.push(loopVariable, loopType)
+		first = 2
+	}
+	mark := c.mark()
+	if len(r.Pipe.Decl) > 0 {
+		c.setTop(first, elem)
+	}
+	if len(r.Pipe.Decl) > 1 {
+		c.setTop(first+1, key)
+	}
+	c.walk(elem, r.List)
+	c.pop(mark)
+	if r.ElseList != nil {
+		c.walk(dot, r.ElseList)
+	}
+}
+
+func (c *checker) walkTemplate(dot reflect.Type, t *parse.TemplateNode) {
+	if t.NameExpr != nil {
+		// The invoked template is only known at execution time.
+		c.arg(dot, nil, t.NameExpr)
+		c.pipeline(dot, t.Pipe)
+		c.namedArgs(dot, nil, t.Args)
+		return
+	}
+	tmpl := c.tmpl.Lookup(t.Name)
+	if t.Block && c.layout != nil {
+		if tree := c.layout.Blocks[t.Name]; tree != nil {
+			tmpl = c.layout.block(t.Name, tree)
+		}
+	}
+	if tmpl == nil || tmpl.Tree == nil {
+		c.errorf(t, "template %q not defined", t.Name)
+	}
+	value := c.pipeline(dot, t.Pipe)
+	c.namedArgs(dot, tmpl, t.Args)
+	c.template(tmpl, value)
+}
+
+// namedArgs checks the named arguments supplied to tmpl (nil if unknown).
+func (c *checker) namedArgs(dot reflect.Type, tmpl *Template, args []*parse.NamedArg) {
+	for _, arg := range args {
+		if tmpl != nil && tmpl.Tree != nil && !tmpl.hasParam(arg.Name) {
+			c.errorf(arg.Value, "template %q has no parameter %s", tmpl.Name(), arg.Name)
+		}
+		c.arg(dot, nil, arg.Value)
+	}
+}
+
+// pipeline returns the static type of the pipeline and declares its variables.
+func (c *checker) pipeline(dot reflect.Type, pipe *parse.PipeNode) (value reflect.Type) {
+	if pipe == nil {
+		return nil
+	}
+	value = missingType
+	for _, cmd := range pipe.Cmds {
+		value = c.command(dot, cmd, value)
+		if value != nil && value.Kind() == reflect.Interface && value.NumMethod() == 0 {
+			value = nil
+		}
+	}
+	for _, variable := range pipe.Decl {
+		if pipe.IsAssign {
+			c.setVar(variable.Ident[0], value)
+		} else {
+			c.push(variable.Ident[0], value)
+		}
+	}
+	return value
+}
+
+func (c *checker) notAFunction(args []parse.Node, final reflect.Type) {
+	if len(args) > 1 || final != missingType {
+		c.errorf(args[0], "can't give argument to non-function %s", args[0])
+	}
+}
+
+func (c *checker) command(dot reflect.Type, cmd *parse.CommandNode, final reflect.Type) reflect.Type {
+	switch n := cmd.Args[0].(type) {
+	case *parse.FieldNode:
+		return c.fieldChain(dot, dot, n, n.Ident, cmd.Args, final)
+	case *parse.ChainNode:
+		return c.fieldChain(dot, c.arg(dot, nil, n.Node), n, n.Field, cmd.Args, final)
+	case *parse.IdentifierNode:
+		return c.function(dot, n, cmd.Args, final)
+	case *parse.PipeNode:
+		c.notAFunction(cmd.Args, final)
+		return c.pipeline(dot, n)
+	case *parse.VariableNode:
+		return c.variable(dot, n, cmd.Args, final)
+	case *parse.ExprNode:
+		c.notAFunction(cmd.Args, final)
+		return c.expr(dot, n)
+	}
+	c.notAFunction(cmd.Args, final)
+	switch word := cmd.Args[0].(type) {
+	case *parse.BoolNode:
+		return reflect.TypeOf(true)
+	case *parse.DotNode:
+		return dot
+	case *parse.NilNode:
+		c.errorf(word, "nil is not a command")
+	case *parse.NumberNode:
+		return idealType(word)
+	case *parse.StringNode:
+		return reflect.TypeOf("")
+	}
+	return nil
+}
+
+// expr returns the static type of an expression: a boolean for the comparison
+// and negation operators, the type of the operands if they have the same one.
+func (c *checker) expr(dot reflect.Type, expr *parse.ExprNode) reflect.Type {
+	var types []reflect.Type
+	for _, operand := range expr.Operands {
+		switch operand := operand.(type) {
+		case *parse.CommandNode:
+			if nilOperand(operand) {
+				types = append(types, nil)
+				break
+			}
+			types = append(types, c.command(dot, operand, missingType))
+		case *parse.ExprNode:
+			types = append(types, c.expr(dot, operand))
+		}
+	}
+	switch expr.Operator {
+	case "!", "==", "!=", "<", "<=", ">", ">=":
+		return reflect.TypeOf(true)
+	}
+	for _, typ := range types[1:] {
+		if typ != types[0] {
+			return nil
+		}
+	}
+	return types[0]
+}
+
+// idealType returns the type given to a number constant by idealConstant.
+func idealType(constant *parse.NumberNode) reflect.Type {
+	switch {
+	case constant.IsComplex:
+		return reflect.TypeOf(constant.Complex128)
+	case constant.IsFloat &&
+		!isHexInt(constant.Text) && !isRuneInt(constant.Text) &&
+		strings.ContainsAny(constant.Text, ".eEpP"):
+		return reflect.TypeOf(constant.Float64)
+	}
+	return reflect.TypeOf(0)
+}
+
+func (c *checker) variable(dot reflect.Type, variable *parse.VariableNode, args []parse.Node, final reflect.Type) reflect.Type {
+	value := c.varType(variable.Ident[0])
+	if len(variable.Ident) == 1 {
+		c.notAFunction(args, final)
+		return value
+	}
+	return c.fieldChain(dot, value, variable, variable.Ident[1:], args, final)
+}
+
+func (c *checker) fieldChain(dot, receiver reflect.Type, node parse.Node, ident []string, args []parse.Node, final reflect.Type) reflect.Type {
+	n := len(ident)
+	for i := 0; i < n-1; i++ {
+		receiver = c.field(dot, ident[i], node, nil, missingType, receiver)
+	}
+	return c.field(dot, ident[n-1], node, args, final, receiver)
+}
+
+// field returns the static type of .Field applied on receiver, checking the
+// arguments if it is a method.
+func (c *checker) field(dot reflect.Type, fieldName string, node parse.Node, args []parse.Node, final, receiver reflect.Type) reflect.Type {
+	if receiver == nil || receiver.Kind() == reflect.Interface {
+		c.args(dot, args)
+		return nil
+	}
+	ptr := receiver
+	if ptr.Kind() != reflect.Ptr {
+		ptr = reflect.PtrTo(ptr)
+	}
+	if method := reflect.Zero(ptr).MethodByName(fieldName); method.IsValid() {
+		return c.call(dot, method.Type(), node, fieldName, args, final)
+	}
+	hasArgs := len(args) > 1 || final != missingType
+	base := indirectType(receiver)
+	switch base.Kind() {
+	case reflect.Struct:
+		if tField, ok := base.FieldByName(fieldName); ok {
+			switch {
+			case tField.PkgPath != "":
+				c.errorf(node, "%s is an unexported field of struct type %s", fieldName, receiver)
+			case hasArgs:
+				c.errorf(node, "%s has arguments but cannot be invoked as function", fieldName)
+			}
+			return tField.Type
+		}
+	case reflect.Map:
+		if reflect.TypeOf(fieldName).AssignableTo(base.Key()) {
+			if hasArgs {
+				c.errorf(node, "%s is not a method but has arguments", fieldName)
+			}
+			return base.Elem()
+		}
+	case reflect.Interface:
+		c.args(dot, args)
+		return nil
+	}
+	if _, isFunction := findFunction(fieldName, c.tmpl); isFunction && c.tmpl.errorHandlers.managers[FuncsAsMethodsID] != nil {
+		c.args(dot, args)
+		return nil
+	}
+	c.errorf(node, "can't evaluate field %s in type %s", fieldName, receiver)
+	return nil
+}
+
+func (c *checker) function(dot reflect.Type, node *parse.IdentifierNode, args []parse.Node, final reflect.Type) reflect.Type {
+	function, ok := findFunction(node.Ident, c.tmpl)
+	if !ok {
+		c.errorf(node, "%q is not a defined function", node.Ident)
+		return nil
+	}
+	return c.call(dot, function.Type(), node, node.Ident, args, final)
+}
+
+// args checks the arguments supplied to a function whose signature is unknown.
+func (c *checker) args(dot reflect.Type, args []parse.Node) {
+	for i := 1; i < len(args); i++ {
+		c.arg(dot, nil, args[i])
+	}
+}
+
+// call checks the arguments supplied to a function or method of the given type
+// and returns the static type of its result.
+func (c *checker) call(dot, typ reflect.Type, node parse.Node, name string, args []parse.Node, final reflect.Type) reflect.Type {
+	if typ.NumIn() > 0 && typ.In(0) == contextType {
+		// The function handles its arguments itself.
+		c.args(dot, args)
+		return nil
+	}
+	if args != nil {
+		args = args[1:]
+	}
+	first := 0
+	if typ.NumIn() > 0 && typ.In(0) == stdContextType {
+		first = 1
+	}
+	numIn := len(args) + first
+	if final != missingType {
+		numIn++
+	}
+	numFixed := len(args) + first
+	wrongCount := false
+	if typ.IsVariadic() {
+		numFixed = typ.NumIn() - 1
+		if wrongCount = numIn < numFixed; wrongCount {
+			c.errorf(node, "wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1-first, len(args))
+		}
+	} else if wrongCount = numIn != typ.NumIn(); wrongCount {
+		c.errorf(node, "wrong number of args for %s: want %d got %d", name, typ.NumIn()-first, numIn-first)
+	}
+	if wrongCount {
+		for _, arg := range args {
+			c.arg(dot, nil, arg)
+		}
+		return nil
+	}
+
+	i := first
+	for ; i < numFixed && i < len(args)+first; i++ {
+		c.arg(dot, typ.In(i), args[i-first])
+	}
+	if typ.IsVariadic() {
+		argType := typ.In(typ.NumIn() - 1).Elem()
+		for ; i < len(args)+first; i++ {
+			c.arg(dot, argType, args[i-first])
+		}
+	}
+	if final != missingType {
+		t := typ.In(typ.NumIn() - 1)
+		if typ.IsVariadic() {
+			if numIn-1 < numFixed {
+				t = typ.In(numIn - 1)
+			} else {
+				t = t.Elem()
+			}
+		}
+		c.assign(final, t, node)
+	}
+
+	if !goodFunc(typ) {
+		if c.tmpl.errorHandlers.managers[ContextID] == nil {
+			c.errorf(node, "can't call method/function %q with %d results", name, typ.NumOut())
+		}
+		return nil
+	}
+	if result := typ.Out(0); result != reflectValueType && result.Kind() != reflect.Interface {
+		return result
+	}
+	return nil
+}
+
+// assign checks that a value of type value can be supplied as an argument of type typ.
+func (c *checker) assign(value, typ reflect.Type, node parse.Node) {
+	if value == nil || typ == nil || typ == reflectValueType || typ == lazyType || value.Kind() == reflect.Interface {
+		return
+	}
+	switch {
+	case value.AssignableTo(typ):
+	case value.Kind() == reflect.Ptr && value.Elem().AssignableTo(typ):
+	case reflect.PtrTo(value).AssignableTo(typ):
+	default:
+		c.errorf(node, "wrong type for value; expected %s; got %s", typ, value)
+	}
+}
+
+// arg checks an argument that should be of type typ (nil if unknown) and returns its static type.
+func (c *checker) arg(dot, typ reflect.Type, n parse.Node) (result reflect.Type) {
+	switch arg := n.(type) {
+	case *parse.DotNode:
+		result = dot
+	case *parse.NilNode:
+		if typ != nil && !canBeNil(typ) {
+			c.errorf(n, "cannot assign nil to %s", typ)
+		}
+		return typ
+	case *parse.FieldNode:
+		result = c.fieldChain(dot, dot, arg, arg.Ident, []parse.Node{n}, missingType)
+	case *parse.VariableNode:
+		result = c.variable(dot, arg, nil, missingType)
+	case *parse.PipeNode:
+		result = c.pipeline(dot, arg)
+	case *parse.IdentifierNode:
+		result = c.function(dot, arg, nil, missingType)
+	case *parse.ChainNode:
+		result = c.fieldChain(dot, c.arg(dot, nil, arg.Node), arg, arg.Field, nil, missingType)
+	default:
+		return c.constant(typ, n)
+	}
+	c.assign(result, typ, n)
+	return result
+}
+
+// constant checks that the constant node can be supplied as an argument of type typ.
+func (c *checker) constant(typ reflect.Type, n parse.Node) reflect.Type {
+	if typ == nil || typ == reflectValueType || typ == lazyType || typ.Kind() == reflect.Interface && typ.NumMethod() == 0 {
+		switch n := n.(type) {
+		case *parse.BoolNode:
+			return reflect.TypeOf(true)
+		case *parse.NumberNode:
+			return idealType(n)
+		case *parse.StringNode:
+			return reflect.TypeOf("")
+		}
+		return nil
+	}
+	var expected string
+	switch typ.Kind() {
+	case reflect.Bool:
+		if _, ok := n.(*parse.BoolNode); !ok {
+			expected = "bool"
+		}
+	case reflect.Complex64, reflect.Complex128:
+		if n, ok := n.(*parse.NumberNode); !ok || !n.IsComplex {
+			expected = "complex"
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := n.(*parse.NumberNode); !ok || !n.IsFloat {
+			expected = "float"
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := n.(*parse.NumberNode); !ok || !n.IsInt {
+			expected = "integer"
+		}
+	case reflect.String:
+		if _, ok := n.(*parse.StringNode); !ok {
+			expected = "string"
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := n.(*parse.NumberNode); !ok || !n.IsUint {
+			expected = "unsigned integer"
+		}
+	default:
+		c.errorf(n, "can't handle %s for arg of type %s", n, typ)
+		return typ
+	}
+	if expected != "" {
+		c.errorf(n, "expected %s; found %s", expected, n)
+	}
+	return typ
+}
+
+// indirectType returns the type at the end of pointer indirections.
+func indirectType(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
@@ -0,0 +1,146 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type checkItem struct {
+	Name  string
+	Price float64
+	Tags  []string
+}
+
+func (i checkItem) Total(qty int) float64 { return i.Price * float64(qty) }
+
+type checkData struct {
+	Title   string
+	Items   []*checkItem
+	ByName  map[string]checkItem
+	Any     interface{}
+	private int
+}
+
+func (d *checkData) Count() int { return len(d.Items) }
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	funcs := FuncMap{
+		"double": func(i int) int { return i * 2 },
+		"join":   strings.Join,
+		"format": func(f float64, args ...int) string { return fmt.Sprint(f, args) },
+	}
+	dataType := reflect.TypeOf(&checkData{})
+
+	tests := []struct {
+		name   string
+		input  string
+		errors []string
+	}{
+		{"Valid fields", `{{.Title}} {{.Count}} {{len .Items}}`, nil},
+		{"Unknown field", `{{.Missing}}`, []string{
+			`template: t:1:2: checking "t" at <.Missing>: can't evaluate field Missing in type *template.checkData`,
+		}},
+		{"Unexported field", `{{.private}}`, []string{
+			`template: t:1:2: checking "t" at <.private>: private is an unexported field of struct type *template.checkData`,
+		}},
+		{"Range element", `{{range .Items}}{{.Name}}{{.Nme}}{{end}}`, []string{
+			`template: t:1:27: checking "t" at <.Nme>: can't evaluate field Nme in type *template.checkItem`,
+		}},
+		{"Range variables", `{{range $k, $v := .ByName}}{{$k.Len}}{{$v.Price}}{{$v.Cost}}{{end}}`, []string{
+			`template: t:1:31: checking "t" at <$k.Len>: can't evaluate field Len in type string`,
+			`template: t:1:53: checking "t" at <$v.Cost>: can't evaluate field Cost in type template.checkItem`,
+		}},
+		{"Range loop", `{{range .Items}}{{$loop.Number}}{{$loop.Parent.Index}}{{$loop.Count}}{{end}}`, []string{
+			`template: t:1:61: checking "t" at <$loop.Count>: can't evaluate field Count in type *template.Loop`,
+		}},
+		{"Nil operand", `{{if .Any == nil}}{{end}}{{$b := nil != .Items}}{{$b.Not}}`, []string{
+			`template: t:1:52: checking "t" at <$b.Not>: can't evaluate field Not in type bool`,
+		}},
+		{"Operators", `{{$t := .Title + "s"}}{{$t.Len}}{{$b := .Count > 1 && !.Any}}{{$b.Not}}{{(.Count * 2).Half}}{{.Missing + 1}}`, []string{
+			`template: t:1:26: checking "t" at <$t.Len>: can't evaluate field Len in type string`,
+			`template: t:1:65: checking "t" at <$b.Not>: can't evaluate field Not in type bool`,
+			`template: t:1:85: checking "t" at <(.Count * 2).Half>: can't evaluate field Half in type int`,
+			`template: t:1:94: checking "t" at <.Missing>: can't evaluate field Missing in type *template.checkData`,
+		}},
+		{"With", `{{with index .Items 0}}{{.Unknown}}{{end}}{{with .ByName}}{{.key.Name}}{{.key.Bad}}{{end}}`, []string{
+			`template: t:1:77: checking "t" at <.key.Bad>: can't evaluate field Bad in type template.checkItem`,
+		}},
+		{"Interface", `{{.Any.Whatever.Deep}}`, nil},
+		{"Method arguments", `{{range .Items}}{{.Total 2}}{{.Total}}{{.Total "2"}}{{end}}`, []string{
+			`template: t:1:30: checking "t" at <.Total>: wrong number of args for Total: want 1 got 0`,
+			`template: t:1:47: checking "t" at <"2">: expected integer; found "2"`,
+		}},
+		{"Function arguments", `{{double 1}}{{double}}{{double 1 2}}{{double .Title}}{{3 | double}}{{.Title | double}}`, []string{
+			`template: t:1:14: checking "t" at <double>: wrong number of args for double: want 1 got 0`,
+			`template: t:1:24: checking "t" at <double>: wrong number of args for double: want 1 got 2`,
+			`template: t:1:45: checking "t" at <.Title>: wrong type for value; expected int; got string`,
+			`template: t:1:78: checking "t" at <double>: wrong type for value; expected int; got string`,
+		}},
+		{"Variadic", `{{format 1.5}}{{format 1.5 1 2}}{{format}}{{format 1.5 "x"}}{{join (index .Items 0).Tags ","}}`, []string{
+			`template: t:1:34: checking "t" at <format>: wrong number of args for format: want at least 1 got 0`,
+			`template: t:1:55: checking "t" at <"x">: expected integer; found "x"`,
+		}},
+		{"Function result", `{{(double 2).Bad}}`, []string{
+			`template: t:1:12: checking "t" at <(double 2).Bad>: can't evaluate field Bad in type int`,
+		}},
+		{"Variables", `{{$x := index .Items 0}}{{$item := .ByName.key}}{{$item.Name}}{{$item = .Title}}{{$item.Name}}`, []string{
+			`template: t:1:87: checking "t" at <$item.Name>: can't evaluate field Name in type string`,
+		}},
+		{"Templates", `{{define "item"}}{{.Name}}{{.Bad}}{{end}}{{range .Items}}{{template "item" .}}{{end}}{{template "missing"}}`, []string{
+			`template: t:1:28: checking "item" at <.Bad>: can't evaluate field Bad in type *template.checkItem`,
+			`template: t:1:96: checking "t" at <{{template "missing"}}>: template "missing" not defined`,
+		}},
+		{"Dynamic template", `{{template .Title .}}{{template .Kind .}}`, []string{
+			`template: t:1:32: checking "t" at <.Kind>: can't evaluate field Kind in type *template.checkData`,
+		}},
+		{"Template parameters", `{{define "card" title size=.Count}}{{$title.Bad}}{{.Title}}{{end}}{{template "card" . title=.Title color=.Bad}}`, []string{
+			`template: t:1:105: checking "t" at <.Bad>: template "card" has no parameter color`,
+			`template: t:1:105: checking "t" at <.Bad>: can't evaluate field Bad in type *template.checkData`,
+		}},
+		{"Extends", `{{define "base"}}{{block "title" .}}{{.Title}}{{end}}{{end}}{{extends "base"}}{{block "title" .}}{{.Name}}{{super}}{{end}}`, []string{
+			`template: t:1:99: checking "title" at <.Name>: can't evaluate field Name in type *template.checkData`,
+		}},
+		{"Extends undefined", `{{extends "base"}}`, []string{
+			`template: t:1:0: checking "t" at <>: template "base" extended by "t" not defined`,
+		}},
+		{"Recursive template", `{{define "r"}}{{.Title}}{{template "r" .}}{{end}}{{template "r" .}}`, nil},
+		{"Not invoked template", `{{define "other"}}{{.Other}}{{end}}`, []string{
+			`template: t:1:20: checking "other" at <.Other>: can't evaluate field Other in type *template.checkData`,
+		}},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := Must(New("t").Funcs(funcs).Parse(tc.input))
+			err := tmpl.Check(dataType)
+			if tc.errors == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var checkErrors CheckErrors
+			if assert.True(t, errors.As(err, &checkErrors), "%v", err) {
+				messages := make([]string, len(checkErrors))
+				for i := range checkErrors {
+					messages[i] = checkErrors[i].Error()
+				}
+				assert.Equal(t, tc.errors, messages)
+			}
+		})
+	}
+}
+
+func TestCheckFunctionsAsMethods(t *testing.T) {
+	t.Parallel()
+	tmpl := Must(New("t").Option(FunctionsAsMethods).Funcs(FuncMap{"upper": strings.ToUpper}).Parse(`{{.Title.upper}}{{.Title.lower}}`))
+	assert.EqualError(t, tmpl.Check(reflect.TypeOf(checkData{})),
+		`template: t:1:24: checking "t" at <.Title.lower>: can't evaluate field lower in type string`)
+}
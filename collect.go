@@ -0,0 +1,110 @@
+package template
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/jocgir/template/parse"
+)
+
+// CollectErrors is an option that makes the execution continue after an error.
+// The failing action is replaced by the Placeholder in the output and Execute
+// returns an ExecErrors listing all the errors encountered.
+//
+// Errors caused by a cancelled context, an exceeded budget or a sandbox violation
+// still stop the execution.
+//
+//   template.New("report").Option(template.CollectErrors{Placeholder: "#ERROR"})
+type CollectErrors struct {
+	Placeholder string // Text printed in place of a failing action.
+}
+
+// ExecErrors is the error returned by Execute when CollectErrors is enabled.
+// It lists every ExecError encountered during the execution.
+type ExecErrors []ExecError
+
+func (e ExecErrors) Error() string {
+	messages := make([]string, len(e))
+	for i := range e {
+		messages[i] = e[i].Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap returns the collected errors.
+func (e ExecErrors) Unwrap() []error {
+	result := make([]error, len(e))
+	for i := range e {
+		result[i] = e[i]
+	}
+	return result
+}
+
+// Is reports whether any of the collected errors matches target. The errors package
+// only relies on Unwrap() []error since Go 1.20.
+func (e ExecErrors) Is(target error) bool {
+	for i := range e {
+		if errors.Is(e[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first collected error that matches target, and if so, sets target to
+// that error value and returns true.
+func (e ExecErrors) As(target interface{}) bool {
+	for i := range e {
+		if errors.As(e[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// collector holds the errors collected during an execution.
+// It is shared by all states of a single execution.
+type collector struct {
+	CollectErrors
+	errors ExecErrors
+}
+
+func newCollector(t *Template) *collector {
+	if t.common == nil || t.option.collect == nil {
+		return nil
+	}
+	return &collector{CollectErrors: *t.option.collect}
+}
+
+// collect is deferred while walking a node to record its error and continue
+// the execution with the next node.
+func (s *state) collect(node parse.Node) {
+	rec := recover()
+	err, isExecError := rec.(ExecError)
+	if !isExecError || s.fatal(err) {
+		if rec != nil {
+			panic(rec)
+		}
+		return
+	}
+	s.collector.errors = append(s.collector.errors, err)
+	if action, isAction := node.(*parse.ActionNode); isAction && !action.Pipe.IsAssign {
+		// Declare the variables anyway to avoid errors in subsequent actions.
+		for _, variable := range action.Pipe.Decl {
+			s.push(variable.Ident[0], reflect.Value{})
+		}
+	}
+	if _, err := io.WriteString(s.output(), s.collector.Placeholder); err != nil {
+		s.writeError(err)
+	}
+}
+
+// collected returns the errors collected during the execution, if any.
+func (s *state) collected() error {
+	if s.collector == nil || len(s.collector.errors) == 0 {
+		return nil
+	}
+	return s.collector.errors
+}
@@ -0,0 +1,133 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		input       string
+		data        interface{}
+		placeholder string
+		limits      Limits
+		result      string
+		errors      []string
+	}{
+		{
+			name:   "No error",
+			input:  `Hello {{.}}!`,
+			data:   "world",
+			result: "Hello world!",
+		},
+		{
+			name:   "Single error",
+			input:  `Hello {{.Name}}!`,
+			data:   1,
+			result: "Hello !",
+			errors: []string{
+				`template: t:1:8: executing "t" at <.Name>: can't evaluate field Name in type int`,
+			},
+		},
+		{
+			name:        "Many errors with placeholder",
+			input:       `{{.A}} {{.B}} {{.}}`,
+			data:        1,
+			placeholder: "#ERR",
+			result:      "#ERR #ERR 1",
+			errors: []string{
+				`template: t:1:2: executing "t" at <.A>: can't evaluate field A in type int`,
+				`template: t:1:9: executing "t" at <.B>: can't evaluate field B in type int`,
+			},
+		},
+		{
+			name:   "Failing declaration",
+			input:  `{{$x := .A}}[{{$x}}]`,
+			data:   1,
+			result: "[<no value>]",
+			errors: []string{
+				`template: t:1:8: executing "t" at <.A>: can't evaluate field A in type int`,
+			},
+		},
+		{
+			name:        "Error in block",
+			input:       `{{range .}}{{.X}}{{end}}|{{if .Y}}y{{end}}`,
+			data:        []int{1, 2},
+			placeholder: "?",
+			result:      "??|?",
+			errors: []string{
+				`template: t:1:13: executing "t" at <.X>: can't evaluate field X in type int`,
+				`template: t:1:13: executing "t" at <.X>: can't evaluate field X in type int`,
+				`template: t:1:30: executing "t" at <.Y>: can't evaluate field Y in type []int`,
+			},
+		},
+		{
+			name:   "Error in nested template",
+			input:  `{{define "a"}}<{{.Z}}>{{end}}{{template "a" .}}{{template "b"}}`,
+			data:   1,
+			result: "<>",
+			errors: []string{
+				`template: t:1:17: executing "a" at <.Z>: can't evaluate field Z in type int`,
+				`template: t:1:58: executing "t" at <{{template "b"}}>: template "b" not defined`,
+			},
+		},
+		{
+			name:   "Limit still stops",
+			input:  `{{.A}}{{range .}}{{.}}{{end}}`,
+			data:   []int{1, 2, 3},
+			limits: Limits{MaxIterations: 2},
+			errors: []string{
+				`template: t:1:19: executing "t" at <{{.}}>: exceeded maximum range iterations (2)`,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := Must(New("t").Option(CollectErrors{tc.placeholder}, tc.limits).Parse(tc.input))
+
+			buffer := new(bytes.Buffer)
+			err := tmpl.Execute(buffer, tc.data)
+			if tc.limits.MaxIterations > 0 {
+				assert.True(t, isLimitError(err))
+				assert.EqualError(t, err, tc.errors[0])
+				return
+			}
+			assert.Equal(t, tc.result, buffer.String())
+			if len(tc.errors) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var execErrors ExecErrors
+			if assert.True(t, errors.As(err, &execErrors)) {
+				messages := make([]string, len(execErrors))
+				for i := range execErrors {
+					messages[i] = execErrors[i].Error()
+				}
+				assert.Equal(t, tc.errors, messages)
+			}
+		})
+	}
+}
+
+func TestExecErrorsMatching(t *testing.T) {
+	t.Parallel()
+
+	tmpl := Must(New("t").Option(CollectErrors{}).Parse(`{{.A}}{{template "b"}}`))
+	err := tmpl.Execute(new(bytes.Buffer), 1)
+	assert.True(t, errors.Is(err, ErrUndefinedTemplate))
+	assert.False(t, errors.Is(err, ErrUndefinedVariable))
+
+	var execError ExecError
+	if assert.True(t, errors.As(err, &execError)) {
+		assert.Equal(t, `template: t:1:2: executing "t" at <.A>: can't evaluate field A in type int`, execError.Error())
+	}
+}
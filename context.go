@@ -1,6 +1,7 @@
 package template
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -22,8 +23,9 @@ type Context struct {
 }
 
 var (
-	nilv        = reflect.Value{}
-	contextType = reflect.TypeOf(&Context{})
+	nilv               = reflect.Value{}
+	contextType        = reflect.TypeOf(&Context{})
+	emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
 )
 
 type (
@@ -34,6 +36,9 @@ type (
 // ClearError is used by error managers to indicate that an error condition has been solved.
 func (c *Context) ClearError() { c.SetError(nil) }
 
+// Context returns the context.Context bound to the current execution (see ExecuteContext).
+func (c *Context) Context() context.Context { return c.state.ctx }
+
 // Current returns the current context designated by dot {{ . }}.
 func (c *Context) Current() reflect.Value { return c.dot }
 
@@ -85,10 +90,25 @@ func (c *Context) Errorf(format string, args ...interface{}) { c.SetError(fmt.Er
 func (c *Context) SetError(err error) { c.err = err }
 
 // StackLen returns the current stack length.
-func (c *Context) StackLen() int { return len(c.state.stack) }
+func (c *Context) StackLen() int { return len(c.calls()) }
 
 // StackPeek returns the nth value in the template calling stack (0 meaning the current function).
-func (c *Context) StackPeek(n int) *StackCall { return c.state.peekStack(n) }
+// Only the function calls are part of it, the {{template}} invocations are reported by ExecError.Stack.
+func (c *Context) StackPeek(n int) *StackCall {
+	calls := c.calls()
+	return calls[len(calls)-n-1]
+}
+
+// calls returns the function calls of the stack, without the template invocations.
+func (c *Context) calls() []*StackCall {
+	calls := make([]*StackCall, 0, len(c.state.stack))
+	for _, call := range c.state.stack {
+		if !call.IsTemplate() {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
 
 // Template returns the current template being evaluated.
 func (c *Context) Template() *Template { return c.state.tmpl }
@@ -105,6 +125,61 @@ func (c *Context) ArgCount() int {
 	return len(c.args)
 }
 
+// Arg evaluates and returns the ith argument supplied to the context, the piped argument
+// being the last one. The other arguments are not evaluated.
+// If there is a receiver, it is returned as the first argument.
+func (c *Context) Arg(i int) interface{} {
+	c.checkArg(i)
+	if i == len(c.args) {
+		if !c.PipelineArg().IsValid() {
+			return nil
+		}
+		return c.PipelineArg().Interface()
+	}
+	if i == 0 && c.Receiver().IsValid() {
+		return c.Receiver().Interface()
+	}
+	return c.evalArg(emptyInterfaceType, c.args[i]).Interface()
+}
+
+// ArgNode returns the node of the ith argument supplied to the context.
+// It returns nil for the receiver and the piped argument since they are not
+// evaluated from an argument node.
+func (c *Context) ArgNode(i int) parse.Node {
+	c.checkArg(i)
+	if i == len(c.args) || i == 0 && c.Receiver().IsValid() {
+		return nil
+	}
+	return c.args[i]
+}
+
+// ArgSource returns the source text of the ith argument supplied to the context,
+// as formatted by the parser. It returns an empty string for the receiver and the
+// piped argument.
+func (c *Context) ArgSource(i int) string {
+	switch node := c.ArgNode(i).(type) {
+	case nil:
+		return ""
+	case *parse.PipeNode:
+		return "(" + node.String() + ")"
+	default:
+		return node.String()
+	}
+}
+
+func (c *Context) checkArg(i int) {
+	if i < 0 || i >= c.ArgCount() {
+		panic(fmt.Errorf("argument index out of range: %d (%d arguments)", i, c.ArgCount()))
+	}
+}
+
+// evalArg evaluates an argument node, keeping the errors reported afterwards
+// located at the call rather than at the argument.
+func (c *Context) evalArg(typ reflect.Type, n parse.Node) reflect.Value {
+	defer func(node parse.Node) { c.state.node = node }(c.state.node)
+	return c.state.evalArg(c.dot, typ, n)
+}
+
 // EvalArgs returns an []interface{} from the supplied arguments.
 // If there is a piped argument, it will be added at the end.
 // If there is a receiver, it will be inserted as the first argument.
@@ -116,7 +191,7 @@ func (c *Context) EvalArgs() []interface{} {
 		if i == 0 && c.Receiver().IsValid() {
 			value = c.Receiver().Interface()
 		} else {
-			value = c.state.evalArg(c.dot, t, arg).Interface()
+			value = c.evalArg(t, arg).Interface()
 		}
 		result = append(result, value)
 	}
@@ -149,6 +224,10 @@ func (c *Context) TryCall(function interface{}) (interface{}, bool) {
 	case reflect.Value:
 		actualFunc = ft
 	case string:
+		if err := c.state.sandboxFunction(ft); err != nil {
+			c.SetError(err)
+			return nil, true
+		}
 		actualFunc = reflect.ValueOf(c.Template().GetBuiltinsMap()[ft])
 		if !actualFunc.IsValid() {
 			actualFunc = reflect.ValueOf(c.Template().GetFuncsMap()[ft])
@@ -167,6 +246,9 @@ func (c *Context) TryCall(function interface{}) (interface{}, bool) {
 	if injectSelf {
 		first = 1
 		args = append(args, reflect.ValueOf(c))
+	} else if typ.NumIn() > 0 && typ.In(0) == stdContextType {
+		first = 1
+		args = append(args, reflect.ValueOf(c.Context()))
 	}
 	numIn := typ.NumIn()
 
@@ -177,7 +259,7 @@ func (c *Context) TryCall(function interface{}) (interface{}, bool) {
 	if typ.IsVariadic() {
 		numIn--
 	} else if c.ArgCount()+first != typ.NumIn() {
-		c.Errorf("wrong number of args for %s: want %d got %d", c.MemberName(), typ.NumIn()-first, c.ArgCount())
+		c.SetError(newRuntimeError(ErrWrongArgCount, "wrong number of args for %s: want %d got %d", c.MemberName(), typ.NumIn()-first, c.ArgCount()))
 		return nil, true
 	}
 
@@ -202,7 +284,7 @@ func (c *Context) TryCall(function interface{}) (interface{}, bool) {
 					}
 				}
 			} else {
-				arg = c.state.evalArg(c.dot, argType, c.args[i])
+				arg = c.evalArg(argType, c.args[i])
 			}
 		} else {
 			arg = c.PipelineArg()
@@ -220,7 +302,15 @@ func (c *Context) convertResult(result []reflect.Value) interface{} {
 	var lenResult = len(result)
 	if result[len(result)-1].Type() == errorType {
 		lenResult--
-		c.err, _ = result[lenResult].Interface().(error)
+		c.ClearError()
+		switch err := result[lenResult].Interface().(type) {
+		case nil:
+		case ExecError:
+			// The error of a template executed by the function is kept as is.
+			c.err = err
+		case error:
+			c.err = newRuntimeError(ErrCallFailed, "%w", err)
+		}
 	} else {
 		c.ClearError()
 	}
@@ -242,6 +332,8 @@ func (c *Context) tryRecover() error {
 					continue
 				}
 				if value, action := handler.fun(c); action != NoReplace {
+					c.state.traceRecover(c, key, action)
+					c.state.debugRecover(c, key)
 					*c.result = reflect.ValueOf(value)
 					result = action
 					if c.Error() == nil {
@@ -284,6 +376,7 @@ func (c *Context) match(re *regexp.Regexp) bool {
 }
 
 type errorHandlers struct {
-	managers map[string]ErrorManagers
-	keys     []string
+	managers   map[string]ErrorManagers
+	priorities map[string]int
+	keys       []string
 }
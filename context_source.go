@@ -14,6 +14,11 @@ const (
 	CallError
 	// Print indicates that the context has been created while evaluating object without String() method.
 	Print
+	// Denied indicates that the context has been created on access denied by the sandbox.
+	Denied
+	// TemplateError indicates that the context has been created on invocation of an undefined template.
+	// The error manager can supply a fallback template by returning its name or a *Template.
+	TemplateError
 	// Call indicates that the context has been created while evaluating function call (context or error).
 	Call = CallContext | CallError
 )
@@ -32,6 +37,12 @@ func (s ContextSource) String() string {
 	if s&Print != 0 {
 		result = append(result, "Print")
 	}
+	if s&Denied != 0 {
+		result = append(result, "Denied")
+	}
+	if s&TemplateError != 0 {
+		result = append(result, "TemplateError")
+	}
 	if len(result) == 0 {
 		return "Undefined"
 	}
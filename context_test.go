@@ -0,0 +1,81 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextArgs(t *testing.T) {
+	t.Parallel()
+
+	funcs := FuncMap{
+		"coalesce": func(context *Context) interface{} {
+			for i := 0; i < context.ArgCount(); i++ {
+				if value := context.Arg(i); value != nil && value != "" {
+					return value
+				}
+			}
+			return nil
+		},
+		"assert": func(context *Context) (string, error) {
+			if truth, _ := IsTrue(context.Arg(0)); !truth {
+				return "", fmt.Errorf("assertion failed: %s", context.ArgSource(0))
+			}
+			return "", nil
+		},
+		"describe": func(context *Context) string {
+			var result string
+			for i := 0; i < context.ArgCount(); i++ {
+				result += fmt.Sprintf("[%v %q]", context.ArgNode(i) != nil, context.ArgSource(i))
+			}
+			return result
+		},
+		"caller": func(context *Context) string {
+			if context.StackLen() < 2 {
+				return ""
+			}
+			caller := context.StackPeek(1)
+			return fmt.Sprintf("%s:%v", caller.Name, caller.IsTemplate())
+		},
+		"arg": func(context *Context) interface{} {
+			defer context.Recover()
+			return context.Arg(5)
+		},
+	}
+	tests := []struct {
+		name   string
+		input  string
+		data   interface{}
+		result string
+		err    string
+	}{
+		{"Only needed arguments are evaluated", `{{coalesce .A .B .C.D}}`, Map{"B": "b"}, "b", ""},
+		{"Piped argument", `{{"p" | coalesce .A}}`, Map{}, "p", ""},
+		{"Assertion succeeded", `{{assert (eq .A 1)}}`, Map{"A": 1}, "", ""},
+		{"Assertion failed", `{{assert (eq .A 1)}}`, Map{"A": 2}, "", `template: t:1:2: executing "t" at <assert>: assertion failed: (eq .A 1)`},
+		{"Sources", `{{"x" | describe .A 'c' "s"}}`, nil, `[true ".A"][true "'c'"][true "\"s\""][false ""]`, ""},
+		{"Receiver", `{{("r").describe .A}}`, nil, `[false ""][true ".A"]`, ""},
+		{"Caller", `{{define "inner"}}{{caller}}|{{print (caller)}}{{end}}{{template "inner"}}`, nil, "|print:false", ""},
+		{"Out of range", `{{arg 1}}`, nil, "", `template: t:1:2: executing "t" at <arg>: argument index out of range: 5 (1 arguments)`},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := Must(New("t").ExtraFuncs(funcs).Option(FunctionsAsMethods).Parse(tc.input))
+
+			buffer := new(bytes.Buffer)
+			err := tmpl.Execute(buffer, tc.data)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, buffer.String())
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jocgir/template/parse"
+)
+
+// Coverage is a Tracer that records which parts of the templates have been executed.
+// The coverage is accumulated over all executions using it and it is reported by
+// blocks: every text, action, {{break}}, {{continue}}, {{super}} and {{template}} invocation,
+// the pipeline of every if, range, switch and with, the variable of every capture and the
+// keyword of every try. The lists they control are covered through the blocks they contain,
+// so that the blocks never overlap, or through the action that ends them if they are empty.
+//
+//   coverage := template.NewCoverage()
+//   t.Option(coverage)
+//   ...
+//   coverage.WriteProfile(os.Stdout)
+//
+// All templates associated with an executed template are reported, even if they
+// have not been invoked.
+type Coverage struct {
+	mu     sync.Mutex
+	trees  map[*parse.Tree]bool
+	blocks map[coverKey]*coverBlock
+}
+
+// coverKey identifies a node in a parse tree.
+type coverKey struct {
+	tree *parse.Tree
+	pos  parse.Pos
+	typ  parse.NodeType
+}
+
+// coverBlock is the source range of a node and its execution count.
+type coverBlock struct {
+	file                                 string
+	startLine, startCol, endLine, endCol int
+	count                                int
+}
+
+// NewCoverage creates a new Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		trees:  make(map[*parse.Tree]bool),
+		blocks: make(map[coverKey]*coverBlock),
+	}
+}
+
+// Percent returns the percentage of blocks that have been executed.
+func (c *Coverage) Percent() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.blocks) == 0 {
+		return 0
+	}
+	var covered int
+	for _, block := range c.blocks {
+		if block.count > 0 {
+			covered++
+		}
+	}
+	return 100 * float64(covered) / float64(len(c.blocks))
+}
+
+// WriteProfile writes the coverage profile to w, using the format of go test -coverprofile
+// with the template file names instead of Go files:
+//   mode: count
+//   file:startLine.startCol,endLine.endCol 1 count
+func (c *Coverage) WriteProfile(w io.Writer) error {
+	c.mu.Lock()
+	blocks := make([]coverBlock, 0, len(c.blocks))
+	for _, block := range c.blocks {
+		blocks = append(blocks, *block)
+	}
+	c.mu.Unlock()
+
+	sort.Slice(blocks, func(i, j int) bool {
+		bi, bj := blocks[i], blocks[j]
+		if bi.file != bj.file {
+			return bi.file < bj.file
+		}
+		if bi.startLine != bj.startLine {
+			return bi.startLine < bj.startLine
+		}
+		if bi.startCol != bj.startCol {
+			return bi.startCol < bj.startCol
+		}
+		return bi.endLine > bj.endLine || bi.endLine == bj.endLine && bi.endCol > bj.endCol
+	})
+	if _, err := fmt.Fprintln(w, "mode: count"); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if _, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d 1 %d\n", b.file, b.startLine, b.startCol, b.endLine, b.endCol, b.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// register adds the blocks of all templates associated with t, unless t has
+// already been registered with them.
+func (c *Coverage) register(t *Template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t.Tree != nil && c.trees[t.Tree] {
+		return
+	}
+	for _, tmpl := range t.Templates() {
+		c.addTree(tmpl)
+		if tmpl.Tree == nil {
+			continue
+		}
+		// The blocks overridden by extending templates are not associated with t.
+		for name, tree := range tmpl.Blocks {
+			c.addTree(tmpl.block(name, tree))
+		}
+	}
+}
+
+// addTree adds the blocks of t if they are not already registered.
+func (c *Coverage) addTree(t *Template) {
+	if t.Tree == nil || t.Root == nil || c.trees[t.Tree] {
+		return
+	}
+	c.trees[t.Tree] = true
+	c.addNode(t, t.Root)
+}
+
+// addNode adds the blocks for node and its children.
+func (c *Coverage) addNode(t *Template, node parse.Node) {
+	var children []*parse.ListNode
+	switch node := node.(type) {
+	case *parse.TryNode:
+		children = branches(node.List, node.Catch)
+	case *parse.CaptureNode:
+		children = branches(node.List, nil)
+	case *parse.IfNode:
+		children = branches(node.List, node.ElseList)
+	case *parse.RangeNode:
+		children = branches(node.List, node.ElseList)
+	case *parse.WithNode:
+		children = branches(node.List, node.ElseList)
+	case *parse.SwitchNode:
+		for _, clause := range node.Cases {
+			children = append(children, clause.List)
+		}
+		if node.Default != nil {
+			children = append(children, node.Default)
+		}
+	case *parse.ListNode:
+		for _, child := range node.Nodes {
+			c.addNode(t, child)
+		}
+		return
+	}
+	c.newBlock(t, node, "")
+	for _, child := range children {
+		if len(child.Nodes) == 0 {
+			// An empty list is covered through the action that ends it, such as {{else}} or {{end}}.
+			left := t.leftDelim
+			if left == "" {
+				left = "{{"
+			}
+			c.newBlock(t, child, left)
+			continue
+		}
+		c.addNode(t, child)
+	}
+}
+
+// newBlock adds the block for the source of node, the left delimiter and trim marker
+// that start the source excluded.
+func (c *Coverage) newBlock(t *Template, node parse.Node, left string) {
+	location, _ := t.ErrorContext(node)
+	line, column := splitLocation(location)
+	block := &coverBlock{file: t.ParseName, startLine: line, startCol: column + 1}
+	text := t.Source(node)
+	if left != "" && strings.HasPrefix(text, left) {
+		trimmed := strings.TrimLeft(strings.TrimPrefix(text[len(left):], "- "), " \t\r\n")
+		block.startLine, block.startCol = advance(line, column+1, text[:len(text)-len(trimmed)])
+		text = trimmed
+	}
+	block.endLine, block.endCol = advance(block.startLine, block.startCol, text)
+	c.blocks[coverKey{t.Tree, node.Position(), node.Type()}] = block
+}
+
+// advance returns the line and the column following text, if it starts at line and column.
+func advance(line, column int, text string) (int, int) {
+	if last := strings.LastIndex(text, "\n"); last >= 0 {
+		return line + strings.Count(text, "\n"), len(text) - last
+	}
+	return line, column + len(text)
+}
+
+func branches(list, elseList *parse.ListNode) []*parse.ListNode {
+	if elseList == nil {
+		return []*parse.ListNode{list}
+	}
+	return []*parse.ListNode{list, elseList}
+}
+
+// TraceNode implements Tracer.
+func (c *Coverage) TraceNode(t *Template, node parse.Node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if block := c.blocks[coverKey{t.Tree, node.Position(), node.Type()}]; block != nil {
+		block.count++
+	}
+}
+
+// TraceCall implements Tracer.
+func (c *Coverage) TraceCall(*Template, CallTrace) {}
+
+// TraceEnter implements Tracer.
+func (c *Coverage) TraceEnter(t *Template) { c.register(t) }
+
+// TraceExit implements Tracer.
+func (c *Coverage) TraceExit(*Template, time.Duration, error) {}
+
+// TraceRecover implements Tracer.
+func (c *Coverage) TraceRecover(*Context, string, ErrorAction) {}
@@ -0,0 +1,74 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoverage(t *testing.T) {
+	t.Parallel()
+
+	coverage := NewCoverage()
+	tmpl := Must(New("t").Option(coverage).Parse(`{{define "unused"}}x{{end}}
+{{- if .}}
+yes {{.}}
+{{- else}}no{{end}}
+{{range .}}{{.}}{{else}}empty{{end}}`))
+
+	assert.NoError(t, tmpl.Execute(new(bytes.Buffer), []int{1}))
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, coverage.WriteProfile(buffer))
+	assert.Equal(t, `mode: count
+t:1.20,1.21 1 0
+t:2.8,2.9 1 1
+t:2.11,3.5 1 1
+t:3.7,3.8 1 1
+t:4.11,4.13 1 0
+t:4.20,5.1 1 1
+t:5.9,5.10 1 1
+t:5.14,5.15 1 1
+t:5.25,5.30 1 0
+`, buffer.String())
+	assert.InDelta(t, 66.7, coverage.Percent(), 0.1)
+
+	assert.NoError(t, tmpl.Execute(new(bytes.Buffer), nil))
+	assert.InDelta(t, 88.9, coverage.Percent(), 0.1)
+}
+
+func TestCoverageSource(t *testing.T) {
+	t.Parallel()
+
+	coverage := NewCoverage()
+	tmpl := Must(New("t").Option(coverage).Parse(`{{define "x"}}{{end}}
+{{- if .}}{{else}}{{print "}}"  -}}
+{{end}}{{template "x" .}}`))
+
+	assert.NoError(t, tmpl.Execute(new(bytes.Buffer), true))
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, coverage.WriteProfile(buffer))
+	assert.Equal(t, `mode: count
+t:2.8,2.9 1 1
+t:2.13,2.17 1 1
+t:2.21,2.31 1 0
+t:3.19,3.24 1 1
+`, buffer.String())
+
+	// The templates parsed separately are covered separately, even if they share their name.
+	other := Must(New("t").Option(coverage).Parse(`{{if .}}{{end}}`))
+	assert.NoError(t, other.Execute(new(bytes.Buffer), false))
+	assert.InDelta(t, 66.7, coverage.Percent(), 0.1)
+}
+
+func TestMultiTracer(t *testing.T) {
+	t.Parallel()
+
+	coverage, profiler := NewCoverage(), NewProfiler()
+	tmpl := Must(New("t").Option(MultiTracer(coverage, profiler)).Parse(`{{len .}}`))
+	assert.NoError(t, tmpl.Execute(new(bytes.Buffer), "abc"))
+	assert.Equal(t, 100.0, coverage.Percent())
+	assert.Len(t, profiler.Functions(), 1)
+}
@@ -0,0 +1,242 @@
+package template
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/jocgir/template/parse"
+)
+
+// DebugHook is called each time the execution is paused by a Debugger.
+// The execution stays paused until the hook returns the command that resumes it.
+type DebugHook func(frame *DebugFrame) DebugCommand
+
+// DebugCommand defines how the execution is resumed after a pause.
+type DebugCommand uint8
+
+const (
+	// DebugContinue resumes the execution until the next breakpoint.
+	DebugContinue DebugCommand = iota
+	// DebugStepOver pauses on the next action of the current template, without entering {{template}} invocations.
+	DebugStepOver
+	// DebugStepInto pauses on the next action, entering {{template}} invocations.
+	DebugStepInto
+	// DebugStepOut pauses on the next action after the current template returned.
+	DebugStepOut
+)
+
+func (c DebugCommand) String() string {
+	switch c {
+	case DebugContinue:
+		return "Continue"
+	case DebugStepOver:
+		return "StepOver"
+	case DebugStepInto:
+		return "StepInto"
+	case DebugStepOut:
+		return "StepOut"
+	}
+	return "Undefined"
+}
+
+// Debugger pauses the execution of templates and reports the execution state to a DebugHook.
+// The execution can be paused before an action, a control structure or a {{template}}
+// invocation runs (text is never paused on), either by a breakpoint or by stepping,
+// and when an error manager replaces a result.
+//
+// A Debugger can be attached to a template through the Option method:
+//   template.New("name").Option(template.NewDebugger(hook).Break("name", 12))
+// or to a single execution through the context supplied to ExecuteContext:
+//   t.ExecuteContext(template.WithDebugger(ctx, debugger), wr, data)
+type Debugger struct {
+	hook        DebugHook
+	mu          sync.RWMutex
+	breakpoints map[string]map[int]bool
+	onErrors    bool
+	onEntry     bool
+}
+
+// NewDebugger creates a Debugger reporting the pauses to hook.
+func NewDebugger(hook DebugHook) *Debugger {
+	return &Debugger{hook: hook, breakpoints: make(map[string]map[int]bool)}
+}
+
+// Break adds breakpoints on the lines of the named template.
+func (d *Debugger) Break(name string, lines ...int) *Debugger {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.breakpoints[name] == nil {
+		d.breakpoints[name] = make(map[int]bool)
+	}
+	for _, line := range lines {
+		d.breakpoints[name][line] = true
+	}
+	return d
+}
+
+// ClearBreak removes breakpoints on the lines of the named template.
+// If no line is supplied, all breakpoints of the template are removed.
+func (d *Debugger) ClearBreak(name string, lines ...int) *Debugger {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(lines) == 0 {
+		delete(d.breakpoints, name)
+	}
+	for _, line := range lines {
+		delete(d.breakpoints[name], line)
+	}
+	return d
+}
+
+// BreakOnErrors indicates whether the execution is paused when an error manager replaces a result.
+func (d *Debugger) BreakOnErrors(enabled bool) *Debugger {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onErrors = enabled
+	return d
+}
+
+// BreakOnEntry indicates whether the execution is paused on the first action.
+func (d *Debugger) BreakOnEntry(enabled bool) *Debugger {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onEntry = enabled
+	return d
+}
+
+func (d *Debugger) hasBreakpoint(name string, line int) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.breakpoints[name][line]
+}
+
+func (d *Debugger) hasBreakpoints(name string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.breakpoints[name]) > 0
+}
+
+// DebugFrame describes the execution state while paused.
+type DebugFrame struct {
+	Template *Template     // Template being executed.
+	Node     parse.Node    // Node about to be executed.
+	Line     int           // Line of the node.
+	Dot      reflect.Value // Current value of dot {{ . }}.
+	context  *Context
+	id       string
+	state    *state
+}
+
+// Global returns the global context designated by {{ $ }}.
+func (f *DebugFrame) Global() reflect.Value { return f.state.vars[0].value }
+
+// Variables returns the variables currently available.
+func (f *DebugFrame) Variables() Map { return f.state.variables() }
+
+// Stack returns the chain of template invocations and function calls, outermost first.
+func (f *DebugFrame) Stack() []StackCall { return f.state.callStack() }
+
+// Depth returns the number of nested {{template}} invocations.
+func (f *DebugFrame) Depth() int { return f.state.depth }
+
+// Context returns the context of the error manager that caused the pause, nil if
+// the pause has not been caused by an error manager.
+func (f *DebugFrame) Context() *Context { return f.context }
+
+// ManagerID returns the id under which the error manager that caused the pause is registered.
+func (f *DebugFrame) ManagerID() string { return f.id }
+
+type debuggerKey struct{}
+
+// WithDebugger returns a copy of ctx that attaches debugger to the executions using it.
+// It takes precedence over the Debugger set on the template.
+func WithDebugger(ctx context.Context, debugger *Debugger) context.Context {
+	return context.WithValue(ctx, debuggerKey{}, debugger)
+}
+
+// debugSession holds the stepping state of an execution.
+// It is shared by all states of a single execution.
+type debugSession struct {
+	*Debugger
+	mode  DebugCommand
+	depth int
+}
+
+func (t *Template) debugSession(ctx context.Context) *debugSession {
+	debugger, _ := ctx.Value(debuggerKey{}).(*Debugger)
+	if debugger == nil && t.common != nil {
+		debugger = t.option.debugger
+	}
+	if debugger == nil {
+		return nil
+	}
+	session := &debugSession{Debugger: debugger}
+	debugger.mu.RLock()
+	defer debugger.mu.RUnlock()
+	if debugger.onEntry {
+		session.mode = DebugStepInto
+	}
+	return session
+}
+
+// debugPosition locates the last node checked for breakpoints by a state.
+type debugPosition struct {
+	name string
+	line int
+	pos  parse.Pos
+}
+
+// debugNode pauses the execution before node if required. A line breakpoint pauses the
+// execution once each time the line is reached, not before every action of the line.
+// The line is reached again if the execution moves back to it, as in a loop.
+func (s *state) debugNode(dot reflect.Value, node parse.Node) {
+	session := s.debug
+	if session == nil {
+		return
+	}
+	switch node.(type) {
+	case *parse.ListNode, *parse.TextNode:
+		return
+	}
+	pause := session.mode == DebugStepInto ||
+		session.mode == DebugStepOver && s.depth <= session.depth ||
+		session.mode == DebugStepOut && s.depth < session.depth
+	name := s.tmpl.Name()
+	if !pause && !session.hasBreakpoints(name) {
+		return
+	}
+	location, _ := s.tmpl.ErrorContext(node)
+	line, _ := splitLocation(location)
+	last := s.debugAt
+	s.debugAt = debugPosition{name, line, node.Position()}
+	reached := last.name != name || last.line != line || node.Position() <= last.pos
+	if pause || reached && session.hasBreakpoint(name, line) {
+		s.pause(&DebugFrame{Template: s.tmpl, Node: node, Line: line, Dot: dot, state: s})
+	}
+}
+
+// debugRecover pauses the execution when an error manager replaced a result if required.
+func (s *state) debugRecover(context *Context, id string) {
+	session := s.debug
+	if session == nil {
+		return
+	}
+	session.mu.RLock()
+	onErrors := session.onErrors
+	session.mu.RUnlock()
+	if !onErrors {
+		return
+	}
+	var line int
+	if context.node != nil {
+		location, _ := s.tmpl.ErrorContext(context.node)
+		line, _ = splitLocation(location)
+	}
+	s.pause(&DebugFrame{Template: s.tmpl, Node: context.node, Line: line, Dot: context.dot, context: context, id: id, state: s})
+}
+
+func (s *state) pause(frame *DebugFrame) {
+	s.debug.mode = s.debug.hook(frame)
+	s.debug.depth = s.depth
+}
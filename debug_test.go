@@ -0,0 +1,139 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugger(t *testing.T) {
+	t.Parallel()
+
+	const text = `{{define "inner"}}
+{{- .}}
+{{- end}}
+{{- $x := 1}}
+{{- template "inner" 2}}
+{{- $x}}
+{{- .Missing}}`
+
+	tests := []struct {
+		name     string
+		debugger func(DebugHook) *Debugger
+		commands []DebugCommand
+		pauses   []string
+	}{
+		{
+			name:     "No breakpoint",
+			debugger: func(hook DebugHook) *Debugger { return NewDebugger(hook) },
+		},
+		{
+			name:     "Breakpoints",
+			debugger: func(hook DebugHook) *Debugger { return NewDebugger(hook).Break("t", 4, 6).Break("inner", 2) },
+			pauses:   []string{"t:4 0 {{$x := 1}}", "inner:2 1 {{.}}", "t:6 0 {{$x}}"},
+		},
+		{
+			name:     "Cleared breakpoints",
+			debugger: func(hook DebugHook) *Debugger { return NewDebugger(hook).Break("t", 4, 6).ClearBreak("t", 4) },
+			pauses:   []string{"t:6 0 {{$x}}"},
+		},
+		{
+			name:     "Step into",
+			debugger: func(hook DebugHook) *Debugger { return NewDebugger(hook).BreakOnEntry(true) },
+			commands: []DebugCommand{DebugStepInto, DebugStepInto, DebugStepInto, DebugContinue},
+			pauses:   []string{"t:4 0 {{$x := 1}}", `t:5 0 {{template "inner" 2}}`, "inner:2 1 {{.}}", "t:6 0 {{$x}}"},
+		},
+		{
+			name:     "Step over",
+			debugger: func(hook DebugHook) *Debugger { return NewDebugger(hook).BreakOnEntry(true) },
+			commands: []DebugCommand{DebugStepOver, DebugStepOver, DebugStepOver, DebugContinue},
+			pauses:   []string{"t:4 0 {{$x := 1}}", `t:5 0 {{template "inner" 2}}`, "t:6 0 {{$x}}", "t:7 0 {{.Missing}}"},
+		},
+		{
+			name:     "Step out",
+			debugger: func(hook DebugHook) *Debugger { return NewDebugger(hook).Break("inner", 2) },
+			commands: []DebugCommand{DebugStepOut, DebugContinue},
+			pauses:   []string{"inner:2 1 {{.}}", "t:6 0 {{$x}}"},
+		},
+		{
+			name:     "Error manager",
+			debugger: func(hook DebugHook) *Debugger { return NewDebugger(hook).BreakOnErrors(true) },
+			pauses:   []string{"t:7 0 .Missing test"},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var pauses []string
+			hook := func(frame *DebugFrame) DebugCommand {
+				pause := fmt.Sprintf("%s:%d %d %s", frame.Template.Name(), frame.Line, frame.Depth(), frame.Node)
+				if frame.Context() != nil {
+					pause += " " + frame.ManagerID()
+				}
+				pauses = append(pauses, pause)
+				if len(tc.commands) < len(pauses) {
+					return DebugContinue
+				}
+				return tc.commands[len(pauses)-1]
+			}
+			tmpl := Must(New("t").Option(tc.debugger(hook)).ErrorManagers("test", NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
+				context.ClearError()
+				return "!", ResultReplaced
+			}).OnMembers("Missing")).Parse(text))
+
+			buffer := new(bytes.Buffer)
+			assert.NoError(t, tmpl.Execute(buffer, 0))
+			assert.Equal(t, "21!", buffer.String())
+			assert.Equal(t, tc.pauses, pauses)
+		})
+	}
+}
+
+func TestDebuggerLineHits(t *testing.T) {
+	t.Parallel()
+
+	var pauses []string
+	debugger := NewDebugger(func(frame *DebugFrame) DebugCommand {
+		pauses = append(pauses, fmt.Sprintf("%s:%d %s", frame.Template.Name(), frame.Line, frame.Node))
+		return DebugContinue
+	}).Break("t", 2)
+
+	tmpl := Must(New("t").Option(debugger).Parse(`{{define "x"}}{{.}}{{end}}
+{{- range .}}{{.}}{{template "x" .}}{{.}}{{end}}
+{{- if true}}{{end}}`))
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, tmpl.Execute(buffer, []int{1, 2}))
+	assert.Equal(t, "111222", buffer.String())
+	// The first iteration belongs to the hit of the range, the second one reaches the line again.
+	assert.Equal(t, []string{`t:2 {{range .}}{{.}}{{template "x" .}}{{.}}{{end}}`, "t:2 {{.}}"}, pauses)
+}
+
+func TestDebugFrame(t *testing.T) {
+	t.Parallel()
+
+	var frames []*DebugFrame
+	debugger := NewDebugger(func(frame *DebugFrame) DebugCommand {
+		if frame.Node.String() == "{{$x}}" {
+			x := frame.Variables()["$x"].(reflect.Value)
+			assert.Equal(t, 1, x.Interface())
+			assert.Equal(t, "data", frame.Global().Interface())
+			assert.Equal(t, []StackCall{{Name: "inner"}}, frame.Stack())
+		}
+		frames = append(frames, frame)
+		return DebugContinue
+	}).Break("inner", 1, 2)
+
+	tmpl := Must(New("t").Parse(`{{define "inner"}}{{$x := 1}}
+{{- $x}}{{end}}{{template "inner" .}}`))
+	assert.NoError(t, tmpl.ExecuteContext(WithDebugger(context.Background(), debugger), new(bytes.Buffer), "data"))
+	if assert.Len(t, frames, 2) {
+		assert.Equal(t, "inner", frames[1].Template.Name())
+		assert.Equal(t, "data", frames[1].Dot.Interface())
+	}
+}
@@ -111,6 +111,20 @@ data, defined in detail in the corresponding sections that follow.
 		T0 is executed; otherwise, dot is set to the successive elements
 		of the array, slice, or map and T1 is executed.
 
+	{{break}}
+		The innermost {{range pipeline}} loop is ended early, stopping the
+		current iteration and bypassing all remaining iterations.
+
+	{{continue}}
+		The current iteration of the innermost {{range pipeline}} loop is
+		stopped, and the loop starts the next iteration.
+
+	{{break n}}
+	{{continue n}}
+		The n innermost {{range pipeline}} loops are exited, n being an
+		integer constant between 1 and the number of enclosing ranges.
+		With continue, the outermost of these loops starts its next iteration.
+
 	{{template "name"}}
 		The template with the specified name is executed with nil data.
 
@@ -118,6 +132,18 @@ data, defined in detail in the corresponding sections that follow.
 		The template with the specified name is executed with dot set
 		to the value of the pipeline.
 
+	{{template operand pipeline}}
+		The name of the template is given by the operand (a field, a
+		variable, a function or a parenthesized pipeline), evaluated at
+		execution time. It must evaluate to a string. If no template is
+		defined with that name, error managers handling the TemplateError
+		source may supply a fallback template.
+
+	{{template "name" pipeline name1=operand name2=operand}}
+		The template is executed with the named arguments assigned to
+		the variables $name1 and $name2 declared as parameters by the
+		template. The pipeline is optional.
+
 	{{block "name" pipeline}} T1 {{end}}
 		A block is shorthand for defining a template
 			{{define "name"}} T1 {{end}}
@@ -125,6 +151,24 @@ data, defined in detail in the corresponding sections that follow.
 			{{template "name" pipeline}}
 		The typical use is to define a set of root templates that are
 		then customized by redefining the block templates within.
+		Named arguments can also be supplied to a block, they are
+		declared as parameters of the block template.
+
+	{{extends "name"}}
+		Placed at the top level of a template, before its content, it
+		makes the template render the template with the specified name
+		instead of its own content, which can thus only contain spaces,
+		blocks and template definitions. The blocks of the extending
+		template are not defined as templates of the set: they
+		override, during its execution only, the blocks with the same
+		names invoked by the extended template. Several templates can thus extend the
+		same template without clobbering each other. The templates
+		invoked with the template action are not affected. The extended
+		template can itself extend another one.
+
+	{{super}}
+		Within a block of an extending template, executes the block it
+		overrides with the same dot and arguments.
 
 	{{with pipeline}} T1 {{end}}
 		If the value of the pipeline is empty, no output is generated;
@@ -136,6 +180,34 @@ data, defined in detail in the corresponding sections that follow.
 		is executed; otherwise, dot is set to the value of the pipeline
 		and T1 is executed.
 
+	{{switch pipeline}} {{case value1 value2}} T1 {{case value3}} T2 {{end}}
+		The value of the pipeline is compared to the values of each case,
+		in order, with the semantics of the eq function; the list of the
+		first matching case is executed. Values are arguments, they can
+		be parenthesized pipelines. Dot is unaffected and only spaces are
+		allowed before the first case.
+
+	{{switch pipeline}} {{case value1}} T1 {{default}} T0 {{end}}
+		If no case matches, T0 is executed. {{else}} can be used instead
+		of {{default}}, it must be if a function named default is defined.
+
+	{{capture $variable}} T1 {{end}}
+		T1 is executed but its output is not written; the variable is
+		declared after the {{end}} with the output as a string, so it
+		can be supplied to functions:
+			{{capture $body}}...{{end}}{{$body | indent 4}}
+		The variables declared in T1 do not persist after the {{end}}.
+
+	{{try}} T1 {{end}}
+	{{try}} T1 {{catch}} T0 {{end}}
+	{{try}} T1 {{catch $error}} T0 {{end}}
+		Available with the Trap option. T1 is executed and its output
+		is only written if it succeeds. If T1 fails, its partial output
+		is discarded and T0, if any, is executed with the ExecError
+		assigned to the variable. Errors caused by a cancelled context,
+		an exceeded budget or a sandbox violation are not caught. The
+		variables declared in T1 and T0 do not persist after the {{end}}.
+
 Arguments
 
 An argument is a simple value, denoted by one of the following.
@@ -259,6 +331,17 @@ array/slice index or map key and element, respectively. Note that if there is
 only one variable, it is assigned the element; this is opposite to the
 convention in Go range clauses.
 
+Within the body of a "range", the variable $loop describes the current
+iteration: $loop.Index and $loop.Number are its 0-based and 1-based indexes,
+$loop.First and $loop.Last report whether it is the first or the last one,
+$loop.Length is the number of iterations (-1 when ranging over a channel) and
+$loop.Parent describes the iteration of the enclosing "range", if any:
+
+	{{range .}}{{if not $loop.First}}, {{end}}{{.}}{{end}}
+
+A variable named $loop declared by the template, including by the range
+itself, shadows the one of the ranges in its scope, which do not declare it.
+
 A variable's scope extends to the "end" action of the control structure ("if",
 "with", or "range") in which it is declared, or to the end of the template if
 there is no such control structure. A template invocation does not inherit
@@ -392,6 +475,53 @@ may be compared with any other integer value. (The arithmetic value is compared,
 not the bit pattern, so all negative integers are less than all unsigned integers.)
 However, as usual, one may not compare an int with a float32 and so on.
 
+Operators
+
+Inside an action, commands may also be combined with operators. From the
+tightest to the loosest binding, they are:
+
+	!  -                      (unary) negation
+	*  /  %                   multiplication, division, remainder
+	+  -                      addition, subtraction, string concatenation
+	==  !=  <  <=  >  >=      comparison
+	&&                        conditional and
+	||                        conditional or
+
+Operators of the same precedence associate to the left and parentheses
+group the operands as usual:
+
+	{{.Qty * .Price + .Tax}}
+	{{if len .Items > 0 && !.Hidden}}
+	{{(.Width - 2) / 2}}
+
+The operators bind less tightly than the application of a function to its
+arguments, so the above test applies > to the result of len. Operators that
+are not at the start of an argument must be separated from it by a space or
+follow an operand: {{.X -1}} passes -1 as argument of .X while {{.X - 1}} and
+{{.X-1}} subtract 1 from .X. As a number takes no arguments, a sign following
+a number that starts a command is an operator: {{3 -1}}, {{3-1}} and {{3 - 1}}
+are 2, while {{print 1 -1}} prints 1 and -1. A number immediately followed by
+a signed imaginary number, such as 1+2i, is a complex constant. An expression
+can't receive the result of the previous command of a pipeline.
+
+The comparison operators follow the rules of the comparison functions and
+the arithmetic operators the same rules for the numbers: both operands must
+be of the same kind, integers, floats or complex numbers, except that signed
+and unsigned integers may be mixed. As in Go, a number constant takes the
+type of the other operand if it can represent it, so {{.Price * 2}} works
+with a float Price; otherwise it is typed as described for arguments. The
+result has the type of the operands if they have the same one. Integer
+division by zero and integer overflow are errors. Any operand can be compared
+with nil by == and !=, which tell whether it is missing or is a nil pointer,
+interface, map, slice, channel or function:
+
+	{{if .Parent != nil}}{{.Parent.Name}}{{end}}
+
+Like the and and or functions, && and || stop the evaluation at the first
+operand that determines the result and return that operand:
+
+	{{.Name || "anonymous"}}
+
 Associated templates
 
 Each template is named by a string specified when it is created. Also, each
@@ -425,6 +555,17 @@ produce the text
 
 	ONE TWO
 
+The name may be followed by parameters, optionally with a default value given
+by an operand, that are declared as variables in the template and receive the
+named arguments supplied by the invocations:
+
+	`{{define "card" title size=3}}{{$title}} ({{$size}}){{end}}
+	{{template "card" title="Hello"}}`
+
+A parameter without argument nor default value has no value. If the DynamicScope
+option is enabled, a parameter without argument takes the value of the variable with
+the same name visible by the invocation, if any, before using its default value.
+
 By construction, a template may reside in only one association. If it's
 necessary to have a template addressable from multiple associations, the
 template definition must be parsed multiple times to create distinct *Template
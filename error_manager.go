@@ -1,6 +1,7 @@
 package template
 
 import (
+	"errors"
 	"reflect"
 	"regexp"
 )
@@ -27,6 +28,9 @@ type ErrorManager struct {
 	members []string
 	filters []*regexp.Regexp
 	kinds   []reflect.Kind
+	types   []reflect.Type
+	targets []error
+	errors  []reflect.Type
 }
 
 // OnSources indicates the error source handled by this manager.
@@ -71,6 +75,42 @@ func (em *ErrorManager) OnKinds(kinds ...reflect.Kind) *ErrorManager {
 	return em
 }
 
+// OnTypes indicates the faulty receiver types handled by this manager.
+// An interface type matches the receivers implementing it.
+// The receiver is only known for the errors raised while evaluating a field or a
+// method (FieldError), the contexts of function and method calls (CallError) have
+// no receiver and never match.
+// Types can be given as reflect.Type or as sample values:
+//   manager.OnTypes(MyData{}, &MyData{}, reflect.TypeOf((*fmt.Stringer)(nil)).Elem())
+func (em *ErrorManager) OnTypes(types ...interface{}) *ErrorManager {
+	for _, typ := range types {
+		em.types = append(em.types, designatedType(typ))
+	}
+	return em
+}
+
+// OnErrors indicates the errors handled by this manager.
+// The current error is matched against the targets with errors.Is.
+func (em *ErrorManager) OnErrors(targets ...error) *ErrorManager {
+	em.targets = append(em.targets, targets...)
+	return em
+}
+
+// OnErrorTypes indicates the types of error handled by this manager.
+// The current error is matched against the types with errors.As.
+// Types can be given as reflect.Type or as sample values:
+//   manager.OnErrorTypes(&MyError{}, reflect.TypeOf((*MyInterface)(nil)).Elem())
+func (em *ErrorManager) OnErrorTypes(types ...interface{}) *ErrorManager {
+	for _, typ := range types {
+		typ := designatedType(typ)
+		if typ == nil || typ.Kind() != reflect.Interface && !typ.Implements(errorType) {
+			panic("template: OnErrorTypes requires error types")
+		}
+		em.errors = append(em.errors, typ)
+	}
+	return em
+}
+
 // CanManage returns true if the error manager can handle the kind of error.
 func (em *ErrorManager) CanManage(context *Context) bool {
 	if em.source != 0 && !em.source.IsSet(context.source) || em.mode != 0 && !em.mode.IsSet(context.Template().MissingMode()) {
@@ -94,6 +134,35 @@ func (em *ErrorManager) CanManage(context *Context) bool {
 			return false
 		}
 	}
+	if len(em.types) > 0 {
+		match := false
+		receiver := context.Receiver()
+		for i := 0; !match && receiver.IsValid() && i < len(em.types); i++ {
+			typ := em.types[i]
+			match = typ == receiver.Type() || typ.Kind() == reflect.Interface && receiver.Type().Implements(typ)
+		}
+		if !match {
+			return false
+		}
+	}
+	if len(em.targets) > 0 {
+		match := false
+		for i := 0; !match && i < len(em.targets); i++ {
+			match = context.Error() != nil && errors.Is(context.Error(), em.targets[i])
+		}
+		if !match {
+			return false
+		}
+	}
+	if len(em.errors) > 0 {
+		match := false
+		for i := 0; !match && i < len(em.errors); i++ {
+			match = context.Error() != nil && errors.As(context.Error(), reflect.New(em.errors[i]).Interface())
+		}
+		if !match {
+			return false
+		}
+	}
 	if context.Error() != nil {
 		for _, re := range em.filters {
 			if context.match(re) {
@@ -103,3 +172,11 @@ func (em *ErrorManager) CanManage(context *Context) bool {
 	}
 	return len(em.filters) == 0
 }
+
+// designatedType returns the type designated by value, either a reflect.Type or a sample value.
+func designatedType(value interface{}) reflect.Type {
+	if typ, isType := value.(reflect.Type); isType {
+		return typ
+	}
+	return reflect.TypeOf(value)
+}
@@ -2,10 +2,12 @@ package template
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -169,7 +171,7 @@ func TestErrorHandling(t *testing.T) {
 			name:   "Calling method with 3 return values and error",
 			input:  `{{.Tuple4 "bang"}}`,
 			data:   &dataWithMethod{},
-			result: err(`template: t:1:10: executing "t" at <"bang">: bang`),
+			result: err(`template: t:1:2: executing "t" at <.Tuple4>: bang`),
 		},
 		{
 			name:   "Calling method with 3 return values and piped error",
@@ -297,6 +299,21 @@ func TestErrorHandling(t *testing.T) {
 			result: `Error: boom!`,
 			funcs:  FuncMap{"fail": func() int { panic("boom!") }},
 		},
+		{
+			name:   "Trap nested error",
+			input:  `{{with trap (print (fail))}}{{else}}Error: {{$error}}{{end}}`,
+			result: `Error: error calling fail: boom!`,
+			funcs:  FuncMap{"fail": func() (int, error) { return 0, errors.New("boom!") }},
+		},
+		{
+			name:   "Trapped error category",
+			input:  `{{with trap fail}}{{else}}{{failed $error}}{{end}}`,
+			result: `true`,
+			funcs: FuncMap{
+				"fail":   func() (int, error) { return 0, errors.New("boom!") },
+				"failed": func(err error) bool { return errors.Is(err, ErrCallFailed) },
+			},
+		},
 		// Test eval function
 		{
 			name:   "Eval function",
@@ -304,6 +321,12 @@ func TestErrorHandling(t *testing.T) {
 			input:  `{{$hello:="Hello"}}{{eval "{{$hello}} {{.somebody}}"}}!`,
 			result: `Hello world!`,
 		},
+		{
+			name:   "Eval function in range",
+			input:  `{{range pair}}{{eval "{{range pair}}{{$loop.Number}}{{end}}"}}{{end}}`,
+			result: `1212`,
+			funcs:  FuncMap{"pair": func() []int { return []int{1, 2} }},
+		},
 	}
 
 	// Set the filter to match only desired test
@@ -368,3 +391,146 @@ func (d *dataWithMethod) Tuple4(format string, args ...interface{}) (int, string
 	}
 	return 4, "four", true, err
 }
+
+var errSentinel = errors.New("sentinel")
+
+type domainError struct{ code int }
+
+func (e *domainError) Error() string { return fmt.Sprintf("domain error %d", e.code) }
+
+func TestErrorManagerMatchers(t *testing.T) {
+	t.Parallel()
+
+	replace := func(context *Context) (interface{}, ErrorAction) {
+		context.ClearError()
+		return "replaced", ResultReplaced
+	}
+	funcs := FuncMap{
+		"sentinel": func() (string, error) { return "", fmt.Errorf("wrapped: %w", errSentinel) },
+		"domain":   func() (string, error) { return "", &domainError{42} },
+	}
+	tests := []struct {
+		name    string
+		input   string
+		data    interface{}
+		manager *ErrorManager
+		result  string
+		err     string
+	}{
+		{
+			name:    "Matching sentinel",
+			input:   `{{sentinel}}`,
+			manager: NewErrorManager(replace).OnErrors(errSentinel),
+			result:  "replaced",
+		},
+		{
+			name:    "Not matching sentinel",
+			input:   `{{domain}}`,
+			manager: NewErrorManager(replace).OnErrors(errSentinel),
+			err:     `template: t:1:2: executing "t" at <domain>: error calling domain: domain error 42`,
+		},
+		{
+			name:    "Matching error type",
+			input:   `{{domain}}`,
+			manager: NewErrorManager(replace).OnErrorTypes(&domainError{}),
+			result:  "replaced",
+		},
+		{
+			name:    "Matching error type given as reflect.Type",
+			input:   `{{domain}}`,
+			manager: NewErrorManager(replace).OnErrorTypes(reflect.TypeOf((*domainError)(nil))),
+			result:  "replaced",
+		},
+		{
+			name:    "Not matching error type",
+			input:   `{{sentinel}}`,
+			manager: NewErrorManager(replace).OnErrorTypes(&domainError{}),
+			err:     `template: t:1:2: executing "t" at <sentinel>: error calling sentinel: wrapped: sentinel`,
+		},
+		{
+			name:    "Matching receiver type",
+			input:   `{{.missing}}`,
+			data:    dataWithMethod{},
+			manager: NewErrorManager(replace).OnTypes(dataWithMethod{}),
+			result:  "replaced",
+		},
+		{
+			name:  "Print error with percent",
+			input: `{{1}}`,
+			manager: NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
+				context.Errorf("100%% wrong")
+				return nil, ResultReplaced
+			}).OnSources(Print),
+			err: `template: t:1:2: executing "t" at <{{1}}>: 100% wrong`,
+		},
+		{
+			name:    "Matching receiver interface",
+			input:   `{{.missing}}`,
+			data:    time.Second,
+			manager: NewErrorManager(replace).OnTypes(reflect.TypeOf((*fmt.Stringer)(nil)).Elem()),
+			result:  "replaced",
+		},
+		{
+			name:    "Not matching receiver type",
+			input:   `{{.missing}}`,
+			data:    dataWithMethod{},
+			manager: NewErrorManager(replace).OnTypes(&dataWithMethod{}),
+			err:     `template: t:1:2: executing "t" at <.missing>: can't evaluate field missing in type template.dataWithMethod`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := Must(New("t").ErrorManagers("test", tc.manager).Funcs(funcs).Parse(tc.input))
+
+			buffer := new(bytes.Buffer)
+			err := tmpl.Execute(buffer, tc.data)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, buffer.String())
+		})
+	}
+
+	assert.Panics(t, func() { NewErrorManager(replace).OnErrorTypes(dataWithMethod{}) })
+}
+
+func TestErrorManagerChain(t *testing.T) {
+	t.Parallel()
+
+	var order []string
+	manager := func(name string) *ErrorManager {
+		return NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
+			order = append(order, name)
+			return nil, NoReplace
+		})
+	}
+	tmpl := New("t").
+		ErrorManagers("B", manager("B")).
+		ErrorManagers("a", manager("a")).
+		ErrorManagersPriority("first", ContextPriority-1, manager("first")).
+		ErrorManagersPriority("last", DefaultPriority+1, manager("last")).
+		Option(FunctionsWithContext, Trap)
+
+	var chain []string
+	for _, group := range tmpl.ErrorManagerChain() {
+		chain = append(chain, fmt.Sprintf("%s:%d", group.ID, group.Priority))
+	}
+	// The ids no longer determine the order relative to the built-in managers.
+	assert.Equal(t, []string{"first:-201", ContextID + ":-200", CallFailID + ":-100", "B:0", "a:0", "last:1"}, chain)
+
+	clone, err := tmpl.Clone()
+	assert.NoError(t, err)
+	assert.Equal(t, tmpl.ErrorManagerChain(), clone.ErrorManagerChain())
+
+	err = Must(tmpl.Parse("{{.missing}}")).Execute(new(bytes.Buffer), 1)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"first", "B", "a", "last"}, order)
+
+	tmpl.ErrorManagers("first")
+	assert.Len(t, tmpl.ErrorManagerChain(), 5)
+}
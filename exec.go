@@ -5,10 +5,13 @@
 package template
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/jocgir/template/fmtsort"
@@ -33,11 +36,21 @@ func initMaxExecDepth() int {
 // can execute in parallel.
 type state struct {
 	tmpl  *Template
+	ctx   context.Context // execution context, checked for cancellation.
 	wr    io.Writer
 	node  parse.Node // current node, for errors
 	vars  []variable // push-down stack of variable values.
 	depth int        // the height of the stack of executing templates.
 
+	budget    *budget    // execution budgets, shared by nested template invocations.
+	collector *collector // errors collected when CollectErrors is enabled.
+	tracer    Tracer     // receives the execution events, if any.
+	debug     *debugSession
+	debugAt   debugPosition  // last node checked for breakpoints.
+	returned  *reflect.Value // value supplied to {{return}}, if any.
+	scope     *scope         // variables of the callers, nil if dynamic scoping is disabled.
+	layout    []*Template    // templates extending the layout being executed, most derived first.
+
 	stack []*StackCall // stack of functions call
 }
 
@@ -71,7 +84,7 @@ func (s *state) setVar(name string, value reflect.Value) {
 			return
 		}
 	}
-	s.errorf("undefined variable: %s", name)
+	s.failf(ErrUndefinedVariable, "undefined variable: %s", name)
 }
 
 // setTopVar overwrites the top-nth variable on the stack. Used by range iterations.
@@ -86,7 +99,7 @@ func (s *state) varValue(name string) reflect.Value {
 			return s.vars[i].value
 		}
 	}
-	s.errorf("undefined variable: %s", name)
+	s.failf(ErrUndefinedVariable, "undefined variable: %s", name)
 	return zero
 }
 
@@ -101,22 +114,17 @@ func (s *state) at(node parse.Node) {
 	s.node = node
 }
 
-// doublePercent returns the string with %'s replaced by %%, if necessary,
-// so it can be used safely inside a Printf format string.
-func doublePercent(str string) string {
-	return strings.ReplaceAll(str, "%", "%%")
-}
-
-// TODO: It would be nice if ExecError was more broken down, but
-// the way ErrorContext embeds the template name makes the
-// processing too clumsy.
-
 // ExecError is the custom error type returned when Execute has an
 // error evaluating its template. (If a write error occurs, the actual
 // error is returned; it will not be of type ExecError.)
 type ExecError struct {
-	Name string // Name of template.
-	Err  error  // Pre-formatted error.
+	Name   string      // Name of template.
+	Err    error       // Pre-formatted error.
+	Line   int         // Line of the failing node, 0 if unknown.
+	Column int         // Byte offset of the failing node within its line.
+	Node   parse.Node  // The failing node, nil if unknown.
+	Cause  error       // Underlying error, without location information.
+	Stack  []StackCall // Chain of template invocations and function calls, outermost first.
 }
 
 func (e ExecError) Error() string {
@@ -129,17 +137,43 @@ func (e ExecError) Unwrap() error {
 
 // errorf records an ExecError and terminates processing.
 func (s *state) errorf(format string, args ...interface{}) {
-	name := doublePercent(s.tmpl.Name())
+	cause := fmt.Errorf(format, args...)
+	if err, isError := singleError(format, args); isError {
+		cause = err
+	}
+	execError := ExecError{
+		Name:  s.tmpl.Name(),
+		Node:  s.node,
+		Cause: cause,
+		Stack: s.callStack(),
+	}
 	if s.node == nil {
-		format = fmt.Sprintf("template: %s: %s", name, format)
+		execError.Err = fmt.Errorf("template: %s: %w", s.tmpl.Name(), cause)
 	} else {
 		location, context := s.tmpl.ErrorContext(s.node)
-		format = fmt.Sprintf("template: %s: executing %q at <%s>: %s", location, name, doublePercent(context), format)
+		execError.Line, execError.Column = splitLocation(location)
+		execError.Err = fmt.Errorf("template: %s: executing %q at <%s>: %w", location, s.tmpl.Name(), context, cause)
 	}
-	panic(ExecError{
-		Name: s.tmpl.Name(),
-		Err:  fmt.Errorf(format, args...),
-	})
+	panic(execError)
+}
+
+// singleError returns the error if the format only wraps a single error.
+func singleError(format string, args []interface{}) (error, bool) {
+	if format != "%w" || len(args) != 1 {
+		return nil, false
+	}
+	err, isError := args[0].(error)
+	return err, isError
+}
+
+// splitLocation extracts the line and column from a location returned by ErrorContext.
+func splitLocation(location string) (line, column int) {
+	parts := strings.Split(location, ":")
+	if len(parts) >= 3 {
+		line, _ = strconv.Atoi(parts[len(parts)-2])
+		column, _ = strconv.Atoi(parts[len(parts)-1])
+	}
+	return
 }
 
 // writeError is the wrapper type used internally when Execute has an
@@ -168,6 +202,8 @@ func errRecover(errp *error) {
 			} else {
 				*errp = nil
 			}
+		case loopControl:
+			*errp = fmt.Errorf("Invalid flow control %s", err)
 		case runtime.Error:
 			panic(e)
 		case writeError:
@@ -209,25 +245,52 @@ func (t *Template) ExecuteTemplate(wr io.Writer, name string, data interface{})
 // If data is a reflect.Value, the template applies to the concrete
 // value that the reflect.Value holds, as in fmt.Print.
 func (t *Template) Execute(wr io.Writer, data interface{}) error {
-	return t.execute(wr, data)
+	return t.execute(context.Background(), wr, data)
+}
+
+func (t *Template) execute(ctx context.Context, wr io.Writer, data interface{}) error {
+	var limits Limits
+	if t.common != nil {
+		limits = t.option.limits
+	}
+	return t.executeWith(ctx, wr, data, newBudget(limits), newCollector(t), 0)
 }
 
-func (t *Template) execute(wr io.Writer, data interface{}) (err error) {
+// executeWith applies the template, consuming the supplied execution budget.
+// If collector is not nil, the errors are collected instead of stopping the execution.
+// The template invocations start at the given depth, which is not 0 for the evaluated expressions.
+func (t *Template) executeWith(ctx context.Context, wr io.Writer, data interface{}, budget *budget, collector *collector, depth int) (err error) {
 	defer errRecover(&err)
 	value, ok := data.(reflect.Value)
 	if !ok {
 		value = reflect.ValueOf(data)
 	}
 	state := &state{
-		tmpl: t,
-		wr:   wr,
-		vars: []variable{{"$", value}},
+		tmpl:      t,
+		ctx:       ctx,
+		wr:        wr,
+		vars:      []variable{{"$", value}},
+		depth:     depth,
+		budget:    budget,
+		collector: collector,
+		tracer:    t.tracer(ctx),
+		debug:     t.debugSession(ctx),
+		scope:     t.scope(ctx),
 	}
 	if t.Tree == nil || t.Root == nil {
-		state.errorf("%q is an incomplete or empty template", t.Name())
+		state.failf(ErrIncompleteTemplate, "%q is an incomplete or empty template", t.Name())
 	}
-	state.walk(value, t.Root)
-	return
+	if state.tracer != nil {
+		defer state.traceExit(t, state.traceEnter(t))
+	}
+	if result, returned := state.walkTemplateRoot(value); returned {
+		// The returned value replaces the whole output if possible.
+		if buffer, isBuffer := wr.(*bytes.Buffer); isBuffer {
+			buffer.Reset()
+		}
+		state.printValue(t.Root, result)
+	}
+	return state.collected()
 }
 
 // DefinedTemplates returns a string listing the defined templates,
@@ -257,6 +320,13 @@ func (t *Template) DefinedTemplates() string {
 // generating output as they go.
 func (s *state) walk(dot reflect.Value, node parse.Node) {
 	s.at(node)
+	s.checkContext()
+	s.step()
+	s.traceNode(node)
+	s.debugNode(dot, node)
+	if s.collector != nil {
+		defer s.collect(node)
+	}
 	switch node := node.(type) {
 	case *parse.ActionNode:
 		// Do not pop variables so they persist until next end.
@@ -265,6 +335,12 @@ func (s *state) walk(dot reflect.Value, node parse.Node) {
 		if len(node.Pipe.Decl) == 0 {
 			s.printValue(node, val)
 		}
+	case *parse.BreakNode:
+		panic(loopControl{fcBreak, node.Levels})
+	case *parse.CaptureNode:
+		s.walkCapture(dot, node)
+	case *parse.ContinueNode:
+		panic(loopControl{fcContinue, node.Levels})
 	case *parse.IfNode:
 		s.walkIfOrWith(parse.NodeIf, dot, node.Pipe, node.List, node.ElseList)
 	case *parse.ListNode:
@@ -273,16 +349,22 @@ func (s *state) walk(dot reflect.Value, node parse.Node) {
 		}
 	case *parse.RangeNode:
 		s.walkRange(dot, node)
+	case *parse.SuperNode:
+		s.walkSuper(node)
+	case *parse.SwitchNode:
+		s.walkSwitch(dot, node)
 	case *parse.TemplateNode:
 		s.walkTemplate(dot, node)
+	case *parse.TryNode:
+		s.walkTry(dot, node)
 	case *parse.TextNode:
-		if _, err := s.wr.Write(node.Text); err != nil {
+		if _, err := s.output().Write(node.Text); err != nil {
 			s.writeError(err)
 		}
 	case *parse.WithNode:
 		s.walkIfOrWith(parse.NodeWith, dot, node.Pipe, node.List, node.ElseList)
 	default:
-		s.errorf("unknown node: %s", node)
+		s.failf(ErrUnknownNode, "unknown node: %s", node)
 	}
 }
 
@@ -293,7 +375,7 @@ func (s *state) walkIfOrWith(typ parse.NodeType, dot reflect.Value, pipe *parse.
 	val := s.evalPipeline(dot, pipe)
 	truth, ok := isTrue(indirectInterface(val))
 	if !ok {
-		s.errorf("if/with can't use %v", val)
+		s.failf(ErrNotTruthful, "if/with can't use %v", val)
 	}
 	if truth {
 		if typ == parse.NodeWith {
@@ -345,16 +427,27 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 	s.at(r)
 	defer s.pop(s.mark())
 	val, _ := indirect(s.evalPipeline(dot, r.Pipe))
+	parent := s.currentLoop()
+	// The $loop variable, if declared, is above the variables of the pipeline.
+	first := 1
+	if r.Loop {
+		s.push(loopVariable, reflect.Value{})
+		first = 2
+	}
 	// mark top of stack before any variables in the body are pushed.
 	mark := s.mark()
-	oneIteration := func(index, elem reflect.Value) {
+	oneIteration := func(loop *Loop, index, elem reflect.Value) {
+		s.iterate()
+		if r.Loop {
+			s.setTopVar(1, reflect.ValueOf(loop))
+		}
 		// Set top var (lexically the second if there are two) to the element.
 		if len(r.Pipe.Decl) > 0 {
-			s.setTopVar(1, elem)
+			s.setTopVar(first, elem)
 		}
 		// Set next var (lexically the first if there are two) to the index.
 		if len(r.Pipe.Decl) > 1 {
-			s.setTopVar(2, index)
+			s.setTopVar(first+1, index)
 		}
 		s.walk(elem, r.List)
 		s.pop(mark)
@@ -365,10 +458,9 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 			break
 		}
 		for i := 0; i < val.Len(); i++ {
-			flow := flow(func() { oneIteration(reflect.ValueOf(i), val.Index(i)) })
-			if flow == fcContinue {
-				continue
-			} else if flow == fcBreak {
+			s.checkContext()
+			loop := newLoop(parent, i, val.Len())
+			if flow(func() { oneIteration(loop, reflect.ValueOf(i), val.Index(i)) }) == fcBreak {
 				break
 			}
 		}
@@ -379,10 +471,9 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 		}
 		om := fmtsort.Sort(val)
 		for i, key := range om.Key {
-			flow := flow(func() { oneIteration(key, om.Value[i]) })
-			if flow == fcContinue {
-				continue
-			} else if flow == fcBreak {
+			s.checkContext()
+			loop := newLoop(parent, i, len(om.Key))
+			if flow(func() { oneIteration(loop, key, om.Value[i]) }) == fcBreak {
 				break
 			}
 		}
@@ -393,14 +484,12 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 		}
 		i := 0
 		for ; ; i++ {
-			elem, ok := val.Recv()
+			elem, ok := s.recv(val)
 			if !ok {
 				break
 			}
-			flow := flow(func() { oneIteration(reflect.ValueOf(i), elem) })
-			if flow == fcContinue {
-				continue
-			} else if flow == fcBreak {
+			loop := newLoop(parent, i, -1)
+			if flow(func() { oneIteration(loop, reflect.ValueOf(i), elem) }) == fcBreak {
 				break
 			}
 		}
@@ -411,30 +500,213 @@ func (s *state) walkRange(dot reflect.Value, r *parse.RangeNode) {
 	case reflect.Invalid:
 		break // An invalid value is likely a nil map, etc. and acts like an empty map.
 	default:
-		s.errorf("range can't iterate over %v", val)
+		s.failf(ErrNotIterable, "range can't iterate over %v", val)
 	}
 	if r.ElseList != nil {
 		s.walk(dot, r.ElseList)
 	}
 }
 
-func (s *state) walkTemplate(dot reflect.Value, t *parse.TemplateNode) {
+// walkSwitch executes the list of the first case having a value equal to the
+// value of the pipeline, as determined by eq, or the default list if none matches.
+func (s *state) walkSwitch(dot reflect.Value, sw *parse.SwitchNode) {
+	s.at(sw)
+	defer s.pop(s.mark())
+	val := s.evalPipeline(dot, sw.Pipe)
+	for _, c := range sw.Cases {
+		values := make([]reflect.Value, len(c.Values))
+		for i, value := range c.Values {
+			values[i] = s.evalArg(dot, reflectValueType, value).Interface().(reflect.Value)
+		}
+		s.at(c)
+		match, err := eq(val, values...)
+		if err != nil {
+			s.failf(ErrWrongType, "can't compare the case values to the value of the switch: %v", err)
+		}
+		if match {
+			s.walk(dot, c.List)
+			return
+		}
+	}
+	if sw.Default != nil {
+		s.walk(dot, sw.Default)
+	}
+}
+
+// walkCapture executes the list of a {{capture}} and declares its variable with
+// the output of the list instead of writing it.
+func (s *state) walkCapture(dot reflect.Value, c *parse.CaptureNode) {
+	s.at(c)
+	var buffer bytes.Buffer
+	wr, mark := s.wr, s.mark()
+	func() {
+		defer func() { s.wr = wr }()
+		s.wr = &buffer
+		s.walk(dot, c.List)
+	}()
+	s.pop(mark)
+	s.push(c.Variable.Ident[0], reflect.ValueOf(buffer.String()))
+}
+
+// walkTry executes the list of a {{try}}. If it raises an ExecError, its output is
+// discarded and the catch list is executed with the error bound to its variable.
+func (s *state) walkTry(dot reflect.Value, t *parse.TryNode) {
 	s.at(t)
-	tmpl := s.tmpl.tmpl[t.Name]
-	if tmpl == nil {
-		s.errorf("template %q not defined", t.Name)
+	err := s.try(dot, t.List)
+	if err == nil || t.Catch == nil {
+		return
 	}
-	if s.depth == maxExecDepth {
-		s.errorf("exceeded maximum template depth (%v)", maxExecDepth)
+	mark := s.mark()
+	if t.Variable != nil {
+		s.push(t.Variable.Ident[0], reflect.ValueOf(err))
 	}
+	s.walk(dot, t.Catch)
+	s.pop(mark)
+}
+
+// try executes list and writes its output once it succeeded. It returns the
+// ExecError raised by list, if any. Fatal errors are not caught; errors are not
+// collected by CollectErrors within list.
+func (s *state) try(dot reflect.Value, list *parse.ListNode) (err error) {
+	var buffer bytes.Buffer
+	wr, mark, collector, stack := s.wr, s.mark(), s.collector, len(s.stack)
+	defer func() {
+		s.wr, s.collector, s.stack = wr, collector, s.stack[:stack]
+		s.pop(mark)
+		rec := recover()
+		if execError, isExecError := rec.(ExecError); isExecError && !s.fatal(execError) {
+			err = execError
+			return
+		}
+		// The output produced before a break, continue or return is kept.
+		if _, writeErr := s.wr.Write(buffer.Bytes()); writeErr != nil {
+			s.writeError(writeErr)
+		}
+		if rec != nil {
+			panic(rec)
+		}
+	}()
+	s.wr, s.collector = &buffer, nil
+	s.walk(dot, list)
+	return nil
+}
+
+func (s *state) walkTemplate(dot reflect.Value, t *parse.TemplateNode) {
+	s.at(t)
+	tmpl := s.lookupTemplate(dot, t)
+	s.checkDepth()
 	// Variables declared by the pipeline persist.
-	dot = s.evalPipeline(dot, t.Pipe)
+	value := s.evalPipeline(dot, t.Pipe)
+	args := s.evalNamedArgs(dot, tmpl, t.Args)
+	// Only the blocks of the layout being executed see its overrides.
+	var layout []*Template
+	if t.Block {
+		layout = s.layout
+	}
+	if result, returned := s.callLayout(tmpl, layout, value, args, s.wr); returned {
+		s.printValue(t, result)
+	}
+}
+
+// evalNamedArgs evaluates the named arguments supplied to tmpl.
+func (s *state) evalNamedArgs(dot reflect.Value, tmpl *Template, args []*parse.NamedArg) map[string]reflect.Value {
+	if len(args) == 0 {
+		return nil
+	}
+	result := make(map[string]reflect.Value, len(args))
+	for _, arg := range args {
+		s.at(arg.Value)
+		if !tmpl.hasParam(arg.Name) {
+			s.failf(ErrUnknownParameter, "template %q has no parameter %s", tmpl.Name(), arg.Name)
+		}
+		result[arg.Name] = s.evalArg(dot, reflectValueType, arg.Value).Interface().(reflect.Value)
+	}
+	return result
+}
+
+// lookupTemplate returns the template invoked by node, evaluating its name if it is dynamic.
+// If the template is not defined, the error managers are given the opportunity to supply
+// a fallback, either as a template name or as a *Template.
+func (s *state) lookupTemplate(dot reflect.Value, node *parse.TemplateNode) *Template {
+	name := node.Name
+	if node.NameExpr != nil {
+		value := s.evalArg(dot, emptyInterfaceType, node.NameExpr).Interface()
+		s.at(node)
+		nameValue := reflect.ValueOf(value)
+		if nameValue.Kind() != reflect.String {
+			s.failf(ErrWrongType, "template name must be a string, got %T", value)
+		}
+		name = nameValue.String()
+	}
+	if node.Block {
+		if tmpl := s.override(name, 0); tmpl != nil {
+			return tmpl
+		}
+	}
+	if tmpl := s.tmpl.tmpl[name]; tmpl != nil {
+		return tmpl
+	}
+	var result reflect.Value
+	err := newRuntimeError(ErrUndefinedTemplate, "template %q not defined", name)
+	if err = s.result(TemplateError, err, name, node, nil, nilv, dot, nilv, nilv, &result); err != nil {
+		s.errorf("%w", err)
+	}
+	var fallback *Template
+	if result.IsValid() {
+		switch value := result.Interface().(type) {
+		case string:
+			fallback = s.tmpl.tmpl[value]
+		case *Template:
+			fallback = value
+		}
+	}
+	if fallback == nil || fallback.Tree == nil {
+		s.failf(ErrUndefinedTemplate, "template %q not defined and no valid fallback supplied", name)
+	}
+	return fallback
+}
+
+// callTemplate executes tmpl with dot and the named arguments args, writing its
+// output to wr. It returns the value supplied to {{return}}, if any.
+func (s *state) callTemplate(tmpl *Template, dot reflect.Value, args map[string]reflect.Value, wr io.Writer) (reflect.Value, bool) {
+	return s.callLayout(tmpl, nil, dot, args, wr)
+}
+
+// callLayout executes tmpl with the blocks overridden by the given layout.
+func (s *state) callLayout(tmpl *Template, layout []*Template, dot reflect.Value, args map[string]reflect.Value, wr io.Writer) (reflect.Value, bool) {
+	s.pushStack(tmpl.Name(), nil)
+	defer s.popStack()
 	newState := *s
 	newState.depth++
 	newState.tmpl = tmpl
+	newState.wr = wr
+	newState.layout = layout
 	// No dynamic scoping: template invocations inherit no variables.
+	// If enabled, dynamic scoping only gives access to the callers' variables to the parameters.
 	newState.vars = []variable{{"$", dot}}
-	newState.walk(dot, tmpl.Root)
+	newState.scope = s.callerScope()
+	if s.tracer != nil {
+		defer s.traceExit(tmpl, s.traceEnter(tmpl))
+	}
+	newState.declareParams(dot, args)
+	return newState.walkTemplateRoot(dot)
+}
+
+// declareParams declares the parameters of the template being executed as variables,
+// using the named arguments supplied by the caller, the caller's variables if dynamic
+// scoping is enabled or the default values.
+// A parameter without argument nor default value has no value.
+func (s *state) declareParams(dot reflect.Value, args map[string]reflect.Value) {
+	for _, param := range s.tmpl.Params {
+		value, supplied := args[param.Name]
+		if !supplied {
+			value, supplied = s.scope.lookup("$" + param.Name)
+		}
+		if !supplied && param.Value != nil {
+			value = s.evalArg(dot, reflectValueType, param.Value).Interface().(reflect.Value)
+		}
+		s.push("$"+param.Name, value)
+	}
 }
 
 // Eval functions evaluate pipelines, commands, and their elements and extract
@@ -470,11 +742,12 @@ func (s *state) evalPipeline(dot reflect.Value, pipe *parse.PipeNode) (value ref
 
 func (s *state) notAFunction(args []parse.Node, final reflect.Value) {
 	if len(args) > 1 || final != missingVal {
-		s.errorf("can't give argument to non-function %s", args[0])
+		s.failf(ErrNotAFunction, "can't give argument to non-function %s", args[0])
 	}
 }
 
 func (s *state) evalCommand(dot reflect.Value, cmd *parse.CommandNode, final reflect.Value) reflect.Value {
+	s.step()
 	firstWord := cmd.Args[0]
 	switch n := firstWord.(type) {
 	case *parse.FieldNode:
@@ -490,6 +763,10 @@ func (s *state) evalCommand(dot reflect.Value, cmd *parse.CommandNode, final ref
 		return s.evalPipeline(dot, n)
 	case *parse.VariableNode:
 		return s.evalVariableNode(dot, n, cmd.Args, final)
+	case *parse.ExprNode:
+		// The operands are all inside the expression; final must be absent.
+		s.notAFunction(cmd.Args, final)
+		return s.evalExpr(dot, n)
 	}
 	s.at(firstWord)
 	s.notAFunction(cmd.Args, final)
@@ -499,13 +776,13 @@ func (s *state) evalCommand(dot reflect.Value, cmd *parse.CommandNode, final ref
 	case *parse.DotNode:
 		return dot
 	case *parse.NilNode:
-		s.errorf("nil is not a command")
+		s.failf(ErrBadCommand, "nil is not a command")
 	case *parse.NumberNode:
 		return s.idealConstant(word)
 	case *parse.StringNode:
 		return reflect.ValueOf(word.Text)
 	}
-	s.errorf("can't evaluate command %q", firstWord)
+	s.failf(ErrBadCommand, "can't evaluate command %q", firstWord)
 	panic("not reached")
 }
 
@@ -530,12 +807,12 @@ func (s *state) idealConstant(constant *parse.NumberNode) reflect.Value {
 	case constant.IsInt:
 		n := int(constant.Int64)
 		if int64(n) != constant.Int64 {
-			s.errorf("%s overflows int", constant.Text)
+			s.failf(ErrIntOverflow, "%s overflows int", constant.Text)
 		}
 		return reflect.ValueOf(n)
 
 	case constant.IsUint:
-		s.errorf("%s overflows int", constant.Text)
+		s.failf(ErrIntOverflow, "%s overflows int", constant.Text)
 	}
 	return zero
 }
@@ -556,10 +833,10 @@ func (s *state) evalFieldNode(dot reflect.Value, field *parse.FieldNode, args []
 func (s *state) evalChainNode(dot reflect.Value, chain *parse.ChainNode, args []parse.Node, final reflect.Value) reflect.Value {
 	s.at(chain)
 	if len(chain.Field) == 0 {
-		s.errorf("internal error: no fields in evalChainNode")
+		s.failf(ErrInternal, "internal error: no fields in evalChainNode")
 	}
 	if chain.Node.Type() == parse.NodeNil {
-		s.errorf("indirection through explicit nil in %s", chain)
+		s.failf(ErrNilPointer, "indirection through explicit nil in %s", chain)
 	}
 	// (pipe).Field1.Field2 has pipe as .Node, fields as .Field. Eval the pipeline, then the fields.
 	pipe := s.evalArg(dot, nil, chain.Node)
@@ -594,7 +871,10 @@ func (s *state) evalFunction(dot reflect.Value, node *parse.IdentifierNode, cmd
 	name := node.Ident
 	function, ok := findFunction(name, s.tmpl)
 	if !ok {
-		s.errorf("%q is not a defined function", name)
+		s.failf(ErrUndefinedFunction, "%q is not a defined function", name)
+	}
+	if err := s.sandboxFunction(name); err != nil {
+		return s.denied(err, name, cmd, args, function, dot, final, nilv)
 	}
 	return s.evalCall(dot, function, cmd, name, args, final)
 }
@@ -610,7 +890,7 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 
 	if !receiver.IsValid() {
 		if s.tmpl.option.missingKey == mapError { // Treat invalid value as missing map key.
-			s.errorf("nil data; no entry for key %q", fieldName)
+			s.failf(ErrNoEntry, "nil data; no entry for key %q", fieldName)
 		}
 		return zero
 	}
@@ -619,7 +899,7 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 	if receiver.Kind() == reflect.Interface && isNil {
 		// Calling a method on a nil interface can't work. The
 		// MethodByName method call below would panic.
-		s.errorf("nil pointer evaluating %s.%s", typ, fieldName)
+		s.failf(ErrNilPointer, "nil pointer evaluating %s.%s", typ, fieldName)
 		return zero
 	}
 
@@ -630,6 +910,9 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 		ptr = ptr.Addr()
 	}
 	if method := ptr.MethodByName(fieldName); method.IsValid() {
+		if err := s.sandboxMember("method", ptr.Type(), fieldName); err != nil {
+			return s.denied(err, fieldName, node, args, method, dot, final, receiver)
+		}
 		return s.evalCall(dot, method, node, fieldName, args, final)
 	}
 	hasArgs := len(args) > 1 || final != missingVal
@@ -640,11 +923,14 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 		if ok {
 			field := receiver.FieldByIndex(tField.Index)
 			if tField.PkgPath != "" { // field is unexported
-				s.errorf("%s is an unexported field of struct type %s", fieldName, typ)
+				s.failf(ErrUnexportedField, "%s is an unexported field of struct type %s", fieldName, typ)
+			}
+			if err := s.sandboxMember("field", receiver.Type(), fieldName); err != nil {
+				return s.denied(err, fieldName, node, args, nilv, dot, final, receiver)
 			}
 			// If it's a function, we must call it.
 			if hasArgs {
-				s.errorf("%s has arguments but cannot be invoked as function", fieldName)
+				s.failf(ErrNotCallable, "%s has arguments but cannot be invoked as function", fieldName)
 			}
 			return field
 		}
@@ -653,7 +939,7 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 		nameVal := reflect.ValueOf(fieldName)
 		if nameVal.Type().AssignableTo(receiver.Type().Key()) {
 			if hasArgs {
-				s.errorf("%s is not a method but has arguments", fieldName)
+				s.failf(ErrNotCallable, "%s is not a method but has arguments", fieldName)
 			}
 			result := receiver.MapIndex(nameVal)
 			if !result.IsValid() {
@@ -663,7 +949,7 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 				case mapZeroValue:
 					result = reflect.Zero(receiver.Type().Elem())
 				case mapError:
-					s.errorf("map has no entry for key %q", fieldName)
+					s.failf(ErrNoEntry, "map has no entry for key %q", fieldName)
 				}
 			}
 			return result
@@ -678,10 +964,10 @@ func (s *state) evalField(dot reflect.Value, fieldName string, node parse.Node,
 			}
 		}
 		if isNil {
-			s.errorf("nil pointer evaluating %s.%s", typ, fieldName)
+			s.failf(ErrNilPointer, "nil pointer evaluating %s.%s", typ, fieldName)
 		}
 	}
-	s.errorf("can't evaluate field %s in type %s", fieldName, typ)
+	s.failf(ErrUnknownField, "can't evaluate field %s in type %s", fieldName, typ)
 	panic("not reached")
 }
 
@@ -713,35 +999,44 @@ func (s *state) evalCall(dot, fun reflect.Value, node parse.Node, name string, a
 		return
 	}
 
-	numIn := len(args)
+	// A leading context.Context parameter is supplied by the execution, not by the template.
+	first := 0
+	if typ.NumIn() > 0 && typ.In(0) == stdContextType {
+		first = 1
+	}
+	numIn := len(args) + first
 	if final != missingVal {
 		numIn++
 	}
-	numFixed := len(args)
+	numFixed := len(args) + first
 	if typ.IsVariadic() {
 		numFixed = typ.NumIn() - 1 // last arg is the variadic one.
 		if numIn < numFixed {
-			s.errorf("wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1, len(args))
+			s.failf(ErrWrongArgCount, "wrong number of args for %s: want at least %d got %d", name, typ.NumIn()-1-first, len(args))
 		}
 	} else if numIn != typ.NumIn() {
-		s.errorf("wrong number of args for %s: want %d got %d", name, typ.NumIn(), numIn)
+		s.failf(ErrWrongArgCount, "wrong number of args for %s: want %d got %d", name, typ.NumIn()-first, numIn-first)
 	}
 	if !goodFunc(typ) {
 		// TODO: This could still be a confusing error; maybe goodFunc should provide info.
-		s.errorf("can't call method/function %q with %d results", name, typ.NumOut())
+		s.failf(ErrBadResults, "can't call method/function %q with %d results", name, typ.NumOut())
 	}
 	// Build the arg list.
 	argv := make([]reflect.Value, numIn)
 	// Args must be evaluated. Fixed args first.
 	i := 0
-	for ; i < numFixed && i < len(args); i++ {
-		argv[i] = s.evalArg(dot, typ.In(i), args[i])
+	if first > 0 {
+		argv[0] = reflect.ValueOf(s.ctx)
+		i++
+	}
+	for ; i < numFixed && i < len(args)+first; i++ {
+		argv[i] = s.evalArg(dot, typ.In(i), args[i-first])
 	}
 	// Now the ... args.
 	if typ.IsVariadic() {
 		argType := typ.In(typ.NumIn() - 1).Elem() // Argument is a slice.
-		for ; i < len(args); i++ {
-			argv[i] = s.evalArg(dot, argType, args[i])
+		for ; i < len(args)+first; i++ {
+			argv[i] = s.evalArg(dot, argType, args[i-first])
 		}
 	}
 	// Add final value if necessary.
@@ -760,15 +1055,22 @@ func (s *state) evalCall(dot, fun reflect.Value, node parse.Node, name string, a
 		}
 		argv[i] = s.validateType(final, t)
 	}
+	start := s.now()
 	v, err := safeCall(fun, argv)
+	s.traceCall(name, node, argv, start, err)
 	// If we have an error that is not nil, stop execution and return that
 	// error to the caller.
 	if err != nil {
-		if s.errorHandled(err) {
+		switch err.(type) {
+		case flowControl, loopControl:
 			panic(err)
 		}
+		if s.errorHandled(err) {
+			// The error is trapped by the caller, it is supplied without location.
+			panic(newRuntimeError(ErrCallFailed, "%w", err))
+		}
 		s.at(node)
-		s.errorf("error calling %s: %v", name, err)
+		s.failf(ErrCallFailed, "error calling %s: %w", name, err)
 	}
 	if v.Type() == reflectValueType {
 		v = v.Interface().(reflect.Value)
@@ -789,6 +1091,9 @@ func canBeNil(typ reflect.Type) bool {
 
 // validateType guarantees that the value is valid and assignable to the type.
 func (s *state) validateType(value reflect.Value, typ reflect.Type) reflect.Value {
+	if typ == lazyType {
+		return lazyValue(value)
+	}
 	if !value.IsValid() {
 		if typ == nil {
 			// An untyped nil interface{}. Accept as a proper nil value.
@@ -798,7 +1103,7 @@ func (s *state) validateType(value reflect.Value, typ reflect.Type) reflect.Valu
 			// Like above, but use the zero value of the non-nil type.
 			return reflect.Zero(typ)
 		}
-		s.errorf("invalid value; expected %s", typ)
+		s.failf(ErrWrongType, "invalid value; expected %s", typ)
 	}
 	if typ == reflectValueType && value.Type() != typ {
 		return reflect.ValueOf(value)
@@ -819,19 +1124,23 @@ func (s *state) validateType(value reflect.Value, typ reflect.Type) reflect.Valu
 		case value.Kind() == reflect.Ptr && value.Type().Elem().AssignableTo(typ):
 			value = value.Elem()
 			if !value.IsValid() {
-				s.errorf("dereference of nil pointer of type %s", typ)
+				s.failf(ErrNilPointer, "dereference of nil pointer of type %s", typ)
 			}
 		case reflect.PtrTo(value.Type()).AssignableTo(typ) && value.CanAddr():
 			value = value.Addr()
 		default:
-			s.errorf("wrong type for value; expected %s; got %s", typ, value.Type())
+			s.failf(ErrWrongType, "wrong type for value; expected %s; got %s", typ, value.Type())
 		}
 	}
 	return value
 }
 
 func (s *state) evalArg(dot reflect.Value, typ reflect.Type, n parse.Node) reflect.Value {
+	if typ == lazyType {
+		return s.lazyArg(dot, n)
+	}
 	s.at(n)
+	s.step()
 	switch arg := n.(type) {
 	case *parse.DotNode:
 		return s.validateType(dot, typ)
@@ -839,7 +1148,7 @@ func (s *state) evalArg(dot reflect.Value, typ reflect.Type, n parse.Node) refle
 		if canBeNil(typ) {
 			return reflect.Zero(typ)
 		}
-		s.errorf("cannot assign nil to %s", typ)
+		s.failf(ErrWrongType, "cannot assign nil to %s", typ)
 	case *parse.FieldNode:
 		return s.validateType(s.evalFieldNode(dot, arg, []parse.Node{n}, missingVal), typ)
 	case *parse.VariableNode:
@@ -873,7 +1182,7 @@ func (s *state) evalArg(dot reflect.Value, typ reflect.Type, n parse.Node) refle
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return s.evalUnsignedInteger(typ, n)
 	}
-	s.errorf("can't handle %s for arg of type %s", n, typ)
+	s.failf(ErrWrongType, "can't handle %s for arg of type %s", n, typ)
 	panic("not reached")
 }
 
@@ -884,7 +1193,7 @@ func (s *state) evalBool(typ reflect.Type, n parse.Node) reflect.Value {
 		value.SetBool(n.True)
 		return value
 	}
-	s.errorf("expected bool; found %s", n)
+	s.failf(ErrWrongType, "expected bool; found %s", n)
 	panic("not reached")
 }
 
@@ -895,7 +1204,7 @@ func (s *state) evalString(typ reflect.Type, n parse.Node) reflect.Value {
 		value.SetString(n.Text)
 		return value
 	}
-	s.errorf("expected string; found %s", n)
+	s.failf(ErrWrongType, "expected string; found %s", n)
 	panic("not reached")
 }
 
@@ -906,7 +1215,7 @@ func (s *state) evalInteger(typ reflect.Type, n parse.Node) reflect.Value {
 		value.SetInt(n.Int64)
 		return value
 	}
-	s.errorf("expected integer; found %s", n)
+	s.failf(ErrWrongType, "expected integer; found %s", n)
 	panic("not reached")
 }
 
@@ -917,7 +1226,7 @@ func (s *state) evalUnsignedInteger(typ reflect.Type, n parse.Node) reflect.Valu
 		value.SetUint(n.Uint64)
 		return value
 	}
-	s.errorf("expected unsigned integer; found %s", n)
+	s.failf(ErrWrongType, "expected unsigned integer; found %s", n)
 	panic("not reached")
 }
 
@@ -928,7 +1237,7 @@ func (s *state) evalFloat(typ reflect.Type, n parse.Node) reflect.Value {
 		value.SetFloat(n.Float64)
 		return value
 	}
-	s.errorf("expected float; found %s", n)
+	s.failf(ErrWrongType, "expected float; found %s", n)
 	panic("not reached")
 }
 
@@ -938,7 +1247,7 @@ func (s *state) evalComplex(typ reflect.Type, n parse.Node) reflect.Value {
 		value.SetComplex(n.Complex128)
 		return value
 	}
-	s.errorf("expected complex; found %s", n)
+	s.failf(ErrWrongType, "expected complex; found %s", n)
 	panic("not reached")
 }
 
@@ -955,7 +1264,7 @@ func (s *state) evalEmptyInterface(dot reflect.Value, n parse.Node) reflect.Valu
 		return s.evalFunction(dot, n, n, nil, missingVal)
 	case *parse.NilNode:
 		// NilNode is handled in evalArg, the only place that calls here.
-		s.errorf("evalEmptyInterface: nil (can't happen)")
+		s.failf(ErrInternal, "evalEmptyInterface: nil (can't happen)")
 	case *parse.NumberNode:
 		return s.idealConstant(n)
 	case *parse.StringNode:
@@ -965,7 +1274,7 @@ func (s *state) evalEmptyInterface(dot reflect.Value, n parse.Node) reflect.Valu
 	case *parse.PipeNode:
 		return s.evalPipeline(dot, n)
 	}
-	s.errorf("can't handle assignment of %s to empty interface argument", n)
+	s.failf(ErrWrongType, "can't handle assignment of %s to empty interface argument", n)
 	panic("not reached")
 }
 
@@ -1001,13 +1310,13 @@ func (s *state) printValue(n parse.Node, v reflect.Value) {
 	s.at(n)
 	iface, ok := printableValue(v)
 	if !ok {
-		s.errorf("can't print %s of type %s", n, v.Type())
+		s.failf(ErrNotPrintable, "can't print %s of type %s", n, v.Type())
 	}
 	// Give the opportunity to external handlers to change the output.
 	if _, ok := iface.(fmt.Stringer); !ok {
 		iface = s.format(Print, n, iface)
 	}
-	_, err := fmt.Fprint(s.wr, iface)
+	_, err := fmt.Fprint(s.output(), iface)
 	if err != nil {
 		s.writeError(err)
 	}
@@ -0,0 +1,70 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+var stdContextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// ExecuteContext applies a parsed template to the specified data object,
+// and writes the output to wr, as Execute does.
+//
+// The execution stops with an error as soon as ctx is cancelled or its
+// deadline expires. The returned error wraps ctx.Err(), so it can be
+// tested with errors.Is(err, context.Canceled) or
+// errors.Is(err, context.DeadlineExceeded).
+//
+// Functions registered through Funcs or ExtraFuncs that declare a
+// context.Context as first parameter receive ctx. Functions working with
+// *Context can get it through Context.Context().
+func (t *Template) ExecuteContext(ctx context.Context, wr io.Writer, data interface{}) error {
+	return t.execute(ctx, wr, data)
+}
+
+// ExecuteTemplateContext applies the template associated with t that has the given name
+// to the specified data object and writes the output to wr, as ExecuteTemplate does.
+// The execution is bound to ctx as described in ExecuteContext.
+func (t *Template) ExecuteTemplateContext(ctx context.Context, wr io.Writer, name string, data interface{}) error {
+	var tmpl *Template
+	if t.common != nil {
+		tmpl = t.tmpl[name]
+	}
+	if tmpl == nil {
+		return fmt.Errorf("template: no template %q associated with template %q", name, t.name)
+	}
+	return tmpl.ExecuteContext(ctx, wr, data)
+}
+
+// checkContext terminates processing if the execution context is done.
+func (s *state) checkContext() {
+	if err := s.ctx.Err(); err != nil {
+		s.errorf("%w", err)
+	}
+}
+
+// cancelled reports whether the error results from the execution context being done.
+// Such errors cannot be managed by the error handlers.
+func (s *state) cancelled(err error) bool {
+	if err == nil {
+		return false
+	}
+	ctxErr := s.ctx.Err()
+	return ctxErr != nil && errors.Is(err, ctxErr)
+}
+
+// recv receives the next element of a channel, giving up if the execution context is done.
+func (s *state) recv(ch reflect.Value) (reflect.Value, bool) {
+	s.checkContext()
+	chosen, elem, ok := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.ctx.Done())},
+	})
+	if chosen == 1 {
+		s.checkContext()
+	}
+	return elem, ok
+}
@@ -0,0 +1,153 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ctxKey string
+
+func TestExecuteContext(t *testing.T) {
+	t.Parallel()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		input  string
+		data   func() interface{}
+		ctx    func() (context.Context, context.CancelFunc)
+		result string
+		err    error
+	}{
+		{
+			name:   "Not cancelled",
+			input:  `{{range .}}{{.}}{{end}}`,
+			data:   func() interface{} { return []int{1, 2, 3} },
+			result: "123",
+		},
+		{
+			name:  "Already cancelled",
+			input: `Hello`,
+			ctx:   func() (context.Context, context.CancelFunc) { return cancelled, func() {} },
+			err:   context.Canceled,
+		},
+		{
+			name:  "Endless channel",
+			input: `{{range .}}{{.}}{{end}}`,
+			data: func() interface{} {
+				ch := make(chan int)
+				go func() {
+					for i := 0; ; i++ {
+						select {
+						case ch <- i:
+						case <-time.After(time.Second):
+							return
+						}
+					}
+				}()
+				return ch
+			},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			err: context.DeadlineExceeded,
+		},
+		{
+			name:  "Blocked channel",
+			input: `{{range .}}{{.}}{{end}}`,
+			data:  func() interface{} { return make(chan int) },
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			err: context.DeadlineExceeded,
+		},
+		{
+			name:  "Recursive template",
+			input: `{{define "loop"}}{{template "loop" .}}{{end}}{{template "loop" .}}`,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 20*time.Millisecond)
+			},
+			err: context.DeadlineExceeded,
+		},
+		{
+			name:  "Cancelled while trapped",
+			input: `{{trap stop}}`,
+			err:   context.Canceled,
+		},
+		{
+			name:   "Function with context",
+			input:  `{{value "user"}}`,
+			result: "John",
+		},
+		{
+			name:   "Extra function with context",
+			input:  `{{pair "user"}}`,
+			result: "[user John]",
+		},
+		{
+			name:   "Function reading context from *Context",
+			input:  `{{fromContext}}`,
+			result: "John",
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var stop context.CancelFunc
+			tmpl := Must(New("t").Option(AllOptions).ExtraFuncs(FuncMap{
+				"value": func(ctx context.Context, key string) interface{} { return ctx.Value(ctxKey(key)) },
+				"pair": func(ctx context.Context, key string) (string, interface{}) {
+					return key, ctx.Value(ctxKey(key))
+				},
+				"fromContext": func(c *Context) interface{} { return c.Context().Value(ctxKey("user")) },
+				"stop": func(ctx context.Context) (string, error) {
+					stop()
+					return "", ctx.Err()
+				},
+			}).Parse(tc.input))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.ctx != nil {
+				ctx, cancel = tc.ctx()
+			}
+			defer cancel()
+			ctx, stop = context.WithCancel(context.WithValue(ctx, ctxKey("user"), "John"))
+			defer stop()
+
+			var data interface{}
+			if tc.data != nil {
+				data = tc.data()
+			}
+			buffer := new(bytes.Buffer)
+			err := tmpl.ExecuteContext(ctx, buffer, data)
+			if tc.err != nil {
+				assert.True(t, errors.Is(err, tc.err), "got %v", err)
+				var execError ExecError
+				assert.True(t, errors.As(err, &execError))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, buffer.String())
+		})
+	}
+}
+
+func TestExecuteTemplateContext(t *testing.T) {
+	t.Parallel()
+	tmpl := Must(New("t").Parse(`{{define "hello"}}Hello {{.}}{{end}}`))
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, tmpl.ExecuteTemplateContext(context.Background(), buffer, "hello", "world"))
+	assert.Equal(t, "Hello world", buffer.String())
+	assert.EqualError(t, tmpl.ExecuteTemplateContext(context.Background(), buffer, "missing", nil),
+		`template: no template "missing" associated with template "t"`)
+}
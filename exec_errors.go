@@ -0,0 +1,55 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors identifying the category of a runtime failure.
+// They are wrapped into ExecError and can be tested with errors.Is:
+//   if errors.Is(err, template.ErrNoEntry) { ... }
+var (
+	ErrIncompleteTemplate = errors.New("incomplete or empty template")
+	ErrUnknownNode        = errors.New("unknown node")
+	ErrUndefinedVariable  = errors.New("undefined variable")
+	ErrUndefinedTemplate  = errors.New("template not defined")
+	ErrUndefinedFunction  = errors.New("function not defined")
+	ErrUnknownParameter   = errors.New("unknown template parameter")
+	ErrBadLayout          = errors.New("invalid template inheritance")
+	ErrNotTruthful        = errors.New("value has no truth value")
+	ErrNotIterable        = errors.New("value cannot be iterated")
+	ErrNotAFunction       = errors.New("arguments given to non-function")
+	ErrBadCommand         = errors.New("command cannot be evaluated")
+	ErrIntOverflow        = errors.New("constant overflows int")
+	ErrNilPointer         = errors.New("nil pointer evaluation")
+	ErrNoEntry            = errors.New("no entry for key")
+	ErrUnexportedField    = errors.New("unexported field")
+	ErrNotCallable        = errors.New("arguments given to non-callable member")
+	ErrUnknownField       = errors.New("field cannot be evaluated")
+	ErrWrongArgCount      = errors.New("wrong number of arguments")
+	ErrBadResults         = errors.New("unsupported function results")
+	ErrCallFailed         = errors.New("function call failed")
+	ErrWrongType          = errors.New("wrong argument type")
+	ErrBadOperation       = errors.New("invalid operation")
+	ErrNotPrintable       = errors.New("value cannot be printed")
+	ErrInternal           = errors.New("internal error")
+)
+
+// runtimeError is a runtime failure message associated with its category.
+type runtimeError struct {
+	category error
+	err      error
+}
+
+func newRuntimeError(category error, format string, args ...interface{}) error {
+	return &runtimeError{category, fmt.Errorf(format, args...)}
+}
+
+func (e *runtimeError) Error() string        { return e.err.Error() }
+func (e *runtimeError) Unwrap() error        { return e.err }
+func (e *runtimeError) Is(target error) bool { return target == e.category }
+
+// failf records an ExecError of the given category and terminates processing.
+func (s *state) failf(category error, format string, args ...interface{}) {
+	s.errorf("%w", newRuntimeError(category, format, args...))
+}
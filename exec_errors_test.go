@@ -0,0 +1,58 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	t.Parallel()
+
+	errBoom := errors.New("boom")
+	funcs := FuncMap{
+		"boom":  func() (string, error) { return "", errBoom },
+		"one":   func(int) int { return 1 },
+		"noArg": func() int { return 0 },
+	}
+	tests := []struct {
+		name     string
+		input    string
+		data     interface{}
+		missing  MissingAction
+		expected error
+	}{
+		{"Undefined variable", `{{$x = 1}}`, nil, Default, ErrUndefinedVariable},
+		{"Undefined template", `{{template "x"}}`, nil, Default, ErrUndefinedTemplate},
+		{"Not iterable", `{{range .}}{{end}}`, 1, Default, ErrNotIterable},
+		{"Not a function", `{{$x := 1}}{{$x 2}}`, nil, Default, ErrNotAFunction},
+		{"Nil pointer", `{{.X}}`, (*struct{ X int })(nil), Default, ErrNilPointer},
+		{"No entry in nil data", `{{.X}}`, nil, Error, ErrNoEntry},
+		{"No entry in map", `{{.X}}`, map[string]int{}, Error, ErrNoEntry},
+		{"Unexported field", `{{.x}}`, struct{ x int }{}, Default, ErrUnexportedField},
+		{"Not callable", `{{.X 1}}`, struct{ X int }{}, Default, ErrNotCallable},
+		{"Unknown field", `{{.X}}`, 1, Default, ErrUnknownField},
+		{"Wrong arg count", `{{one}}`, nil, Default, ErrWrongArgCount},
+		{"Wrong type", `{{one "a"}}`, nil, Default, ErrWrongType},
+		{"Bad operation", `{{1 / 0}}`, nil, Default, ErrBadOperation},
+		{"Call failed", `{{boom}}`, nil, Default, ErrCallFailed},
+		{"Call failed cause", `{{boom}}`, nil, Default, errBoom},
+		{"Not printable", `{{.}}`, func() {}, Default, ErrNotPrintable},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := Must(New("t").Funcs(funcs).Option(tc.missing).Parse(tc.input))
+			err := tmpl.Execute(new(bytes.Buffer), tc.data)
+			assert.True(t, errors.Is(err, tc.expected), "%v is not %v", err, tc.expected)
+			var execError ExecError
+			if assert.True(t, errors.As(err, &execError)) {
+				assert.True(t, errors.Is(execError.Cause, tc.expected))
+			}
+		})
+	}
+}
@@ -579,6 +579,80 @@ var execTests = []execTest{
 	{"declare in range", "{{range $x := .PSI}}<{{$foo:=$x}}{{$x}}>{{end}}", "<21><22><23>", tVal, true},
 	{"range count", `{{range $i, $x := count 5}}[{{$i}}]{{$x}}{{end}}`, "[0]a[1]b[2]c[3]d[4]e", tVal, true},
 	{"range nil count", `{{range $i, $x := count 0}}{{else}}empty{{end}}`, "empty", tVal, true},
+	{"switch", `{{switch .I}}{{case 1 2}}a{{case 17}}b{{default}}c{{end}}`, "b", tVal, true},
+	{"switch multiple values", `{{range .SI}}{{switch .}}{{case 1 3 5}}odd{{case 4}}four{{end}}{{end}}`, "oddfourodd", tVal, true},
+	{"switch default", `{{switch .X}}{{case "a"}}a{{default}}d{{end}}`, "d", tVal, true},
+	{"switch no match", `{{switch .X}}{{case "a"}}a{{end}}`, "", tVal, true},
+	{"switch first match", `{{switch .X}}{{case "x"}}1{{case "x"}}2{{end}}`, "1", tVal, true},
+	{"switch unsigned", `{{switch .U16}}{{case 16}}16{{end}}`, "16", tVal, true},
+	{"switch expression case", `{{switch 3}}{{case (len .SI)}}3{{end}}`, "3", tVal, true},
+	{"switch variable", `{{switch $v := .I}}{{case .I}}{{$v}}{{end}}`, "17", tVal, true},
+	{"switch in range", `{{range .SI}}{{switch .}}{{case 4}}{{break}}{{end}}{{.}}{{end}}`, "3", tVal, true},
+	{"switch incompatible", `{{switch .X}}{{case 1}}{{end}}`, "", tVal, false},
+	{"capture", `{{capture $x}}{{range .SI}}{{.}}{{end}}{{end}}[{{$x}}]`, "[345]", tVal, true},
+	{"capture pipe", `{{capture $x}}a{{.X}}{{end}}{{$x | printf "%q"}}`, `"ax"`, tVal, true},
+	{"capture nested", `{{capture $x}}<{{capture $x}}a{{end}}{{$x}}{{$x}}>{{end}}{{$x}}{{$x}}`, "<aa><aa>", tVal, true},
+	{"capture break", `{{range .SI}}{{capture $x}}{{.}}{{break}}{{end}}{{end}}after`, "after", tVal, true},
+	{"capture error", `{{capture $x}}{{.X}}{{.MyError true}}{{end}}`, "", tVal, false},
+	{"range $loop SI", `{{range .SI}}{{if not $loop.First}}, {{end}}{{$loop.Number}}/{{$loop.Length}}{{end}}`, "1/3, 2/3, 3/3", tVal, true},
+	{"range $loop last", `{{range $x := .SI}}{{$x}}{{if not $loop.Last}},{{end}}{{end}}`, "3,4,5", tVal, true},
+	{"range $loop MSI", `{{range $k, $v := .MSI}}{{$loop.Index}}{{$k}}{{if $loop.Last}}.{{end}}{{end}}`, "0one1three2two.", tVal, true},
+	{"range $loop count", `{{range count 3}}{{$loop.Index}}{{$loop.Last}}{{$loop.Length}}{{end}}`, "0false-11false-12false-1", tVal, true},
+	{"range $loop parent", `{{range .SI}}{{range count 2}}{{$loop.Parent.Number}}{{$loop.Number}} {{end}}{{end}}`, "11 12 21 22 31 32 ", tVal, true},
+	{"range $loop methods", `{{range .SI}}{{$loop.Odd}}{{$loop.Remaining}} {{end}}`, "true2 false1 true0 ", tVal, true},
+	{"range $loop no parent", `{{range .SI}}{{if $loop.Parent}}nested{{end}}{{end}}`, "", tVal, true},
+	{"range $loop shadowed", `{{range .SI}}{{$loop := 7}}{{$loop}}{{end}}`, "777", tVal, true},
+	{"range $loop declared", `{{$loop := 1}}{{range .SI}}{{$loop}}{{end}}`, "111", tVal, true},
+	{"range $loop declared by range", `{{range $loop := .SI}}{{$loop}}{{end}}`, "345", tVal, true},
+	{"range $loop declared by range with index", `{{range $i, $loop := .SI}}{{$i}}{{$loop}}{{end}}`, "031425", tVal, true},
+	{"range $loop in else", `{{range .SI}}{{range $.SIEmpty}}{{else}}{{range count 1}}{{$loop.Parent.Number}}{{end}}{{end}}{{end}}`, "123", tVal, true},
+
+	// Operators.
+	{"op precedence", `{{1 + 2 * 3 - 4 / 2}}`, "5", tVal, true},
+	{"op parens", `{{(1 + 2) * 3}}`, "9", tVal, true},
+	{"op left associative", `{{10 - 4 - 3}}`, "3", tVal, true},
+	{"op modulo", `{{.I % 5}}`, "2", tVal, true},
+	{"op field", `{{.I + .I}}`, "34", tVal, true},
+	{"op function", `{{len .SI * 2}}`, "6", tVal, true},
+	{"op unsigned", `{{.U16 - 6 | printf "%T %[1]v"}}`, "uint16 10", tVal, true},
+	{"op signed and unsigned", `{{.I - .U16 | printf "%T %[1]v"}}`, "int 1", tVal, true},
+	{"op float constant", `{{.FloatZero + 1.5}}`, "1.5", tVal, true},
+	{"op integer constant", `{{.FloatZero + 2 | printf "%T"}}`, "float64", tVal, true},
+	{"op constants", `{{7.0 / 2}} {{7 / 2}}`, "3.5 3", tVal, true},
+	{"op concatenation", `{{.X + "y"}}`, "xy", tVal, true},
+	{"op negation", `{{-.I}}/{{-.FloatZero}}`, "-17/-0", tVal, true},
+	{"op comparison", `{{.I > 10}} {{.I <= 10}} {{.X == "x"}} {{.X != "x"}}`, "true false true false", tVal, true},
+	{"op comparison unsigned", `{{.U16 < .I}}`, "true", tVal, true},
+	{"op not", `{{!.True}} {{!.SIEmpty}}`, "false true", tVal, true},
+	{"op and", `{{.True && .X}} {{.SIEmpty && .X}}`, "x []", tVal, true},
+	{"op or", `{{.X || "none"}} {{"" || "none"}}`, "x none", tVal, true},
+	{"op short circuit", `{{.True || .MyError true}}`, "true", tVal, true},
+	{"op logical precedence", `{{.I > 1 && .I < 10 || .True}}`, "true", tVal, true},
+	{"op in if", `{{if len .SI > 2 && !.SIEmpty}}yes{{end}}`, "yes", tVal, true},
+	{"op in pipeline", `{{.I + 1 | printf "%03d"}}`, "018", tVal, true},
+	{"op in argument", `{{printf "%d" (.I * 2)}}`, "34", tVal, true},
+	{"op declaration", `{{$x := .I - 7}}{{$x / 2}}`, "5", tVal, true},
+	{"op minus sign", `{{print .I -1}}`, "17 -1", tVal, true},
+	{"op adjacent minus", `{{.I-1}}`, "16", tVal, true},
+	{"op adjacent literals", `{{1+1}} {{3-1}} {{1.5+1}} {{0x10-1}} {{'a'-1}}`, "2 2 2.5 15 96", tVal, true},
+	{"op minus after literal", `{{3 -1}} {{(2 +1) * 3}}`, "2 9", tVal, true},
+	{"op minus sign after argument", `{{print 1 -1}}`, "1 -1", tVal, true},
+	{"op complex literal", `{{1+2i}}`, "(1+2i)", tVal, true},
+	{"op nil", `{{.Empty0 == nil}} {{.NIL != nil}} {{nil == .PI}} {{.I == nil}} {{nil == nil}}`, "true false false false true", tVal, true},
+	{"op nil in if", `{{if .MSIEmpty == nil}}nil map{{end}}`, "nil map", tVal, true},
+	{"op nil arithmetic", `{{.I + nil}}`, "", tVal, false},
+	{"op divide by zero", `{{.I / 0}}`, "", tVal, false},
+	{"op overflow", `{{9223372036854775807 + 1}}`, "", tVal, false},
+	{"op overflow product", `{{-9223372036854775807 * 2}}`, "", tVal, false},
+	{"op overflow typed", `{{.U16 * 10000}}`, "", tVal, false},
+	{"op overflow unsigned", `{{.U16 - 17}}`, "", tVal, false},
+	{"op overflow negation", `{{-(-9223372036854775807 - 1)}}`, "", tVal, false},
+	{"op no overflow", `{{-9223372036854775807 - 1}} {{.U16 * 4095}}`, "-9223372036854775808 65520", tVal, true},
+	{"op incompatible", `{{.I * .FloatZero}}`, "", tVal, false},
+	{"op string", `{{.X * 2}}`, "", tVal, false},
+	{"op bool", `{{.True + 1}}`, "", tVal, false},
+	{"op compare", `{{.X < 1}}`, "", tVal, false},
+	{"op negate string", `{{-.X}}`, "", tVal, false},
 
 	// Cute examples.
 	{"or as if true", `{{or .SI "slice is empty"}}`, "[3 4 5]", tVal, true},
@@ -1341,6 +1415,175 @@ func TestExecuteGivesExecError(t *testing.T) {
 	}
 }
 
+var errDomain = errors.New("domain error")
+
+func TestExecErrorDetails(t *testing.T) {
+	text := `{{define "inner"}}
+  {{fail .}}{{end}}{{template "inner" 1}}`
+	tmpl, err := New("outer").Funcs(FuncMap{
+		"fail": func(int) (string, error) { return "", errDomain },
+	}).Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tmpl.Execute(ioutil.Discard, nil)
+	var eerr ExecError
+	if !errors.As(err, &eerr) {
+		t.Fatalf("expected ExecError; got %v", err)
+	}
+	if eerr.Name != "inner" || eerr.Line != 2 || eerr.Column != 4 {
+		t.Errorf("unexpected position %s:%d:%d", eerr.Name, eerr.Line, eerr.Column)
+	}
+	if eerr.Node == nil || eerr.Node.String() != "fail ." {
+		t.Errorf("unexpected node %v", eerr.Node)
+	}
+	if !errors.Is(err, errDomain) || !errors.Is(eerr.Cause, errDomain) {
+		t.Errorf("expected %v to wrap %v", err, errDomain)
+	}
+	stack := eerr.Stack
+	if len(stack) != 2 || stack[0].Name != "inner" || !stack[0].IsTemplate() || stack[1].Name != "fail" || stack[1].IsTemplate() {
+		t.Errorf("unexpected stack %v", stack)
+	}
+}
+
+type recordKind string
+
+func TestDynamicTemplateName(t *testing.T) {
+	const text = `{{define "row_user"}}user {{.Name}}{{end}}{{define "row_group"}}group {{.Name}}{{end}}`
+	tests := []struct {
+		name, input, output, err string
+		data                     interface{}
+	}{
+		{"field", `{{template .Kind .}}`, "user bob", "", map[string]string{"Kind": "row_user", "Name": "bob"}},
+		{"named string type", `{{template .Kind .}}`, "group dev", "", map[string]interface{}{"Kind": recordKind("row_group"), "Name": "dev"}},
+		{"pipeline", `{{range .}}{{template (printf "row_%s" .Type) .}};{{end}}`, "user a;group b;", "",
+			[]map[string]string{{"Type": "user", "Name": "a"}, {"Type": "group", "Name": "b"}}},
+		{"variable", `{{$t := "row_user"}}{{template $t .}}`, "user bob", "", map[string]string{"Name": "bob"}},
+		{"unknown", `{{template .Kind .}}`, "", `template: t:1:97: executing "t" at <{{template .Kind .}}>: template "row_other" not defined`,
+			map[string]string{"Kind": "row_other"}},
+		{"not a string", `{{template .Kind .}}`, "", `template name must be a string, got int`, map[string]int{"Kind": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New("t").Parse(text + test.input))
+			var b strings.Builder
+			err := tmpl.Execute(&b, test.data)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			case test.err == "" && b.String() != test.output:
+				t.Errorf("expected %q, got %q", test.output, b.String())
+			}
+			if test.err != "" && !errors.Is(err, ErrUndefinedTemplate) && !errors.Is(err, ErrWrongType) {
+				t.Errorf("unexpected error category for %v", err)
+			}
+		})
+	}
+}
+
+func TestTemplateFallback(t *testing.T) {
+	tmpl := Must(New("t").Parse(`{{define "row_default"}}default {{.Name}}{{end}}{{template .Kind .}}|{{template "missing"}}`))
+	other := Must(New("other").Parse(`other`))
+	tmpl.ErrorManagers("fallback", NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
+		context.ClearError()
+		if context.MemberName() == "missing" {
+			return other, ResultReplaced
+		}
+		return "row_default", ResultReplaced
+	}).OnSources(TemplateError).OnErrors(ErrUndefinedTemplate))
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]string{"Kind": "row_unknown", "Name": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "default bob|other"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestTemplateNamedArgs(t *testing.T) {
+	const text = `{{define "card" title size=3}}[{{$title}}:{{$size}}:{{.}}]{{end}}`
+	tests := []struct {
+		name, input, output, err string
+	}{
+		{"all", `{{template "card" title=.Name size=5}}`, "[bob:5:<no value>]", ""},
+		{"default", `{{template "card" title="x"}}`, "[x:3:<no value>]", ""},
+		{"no value", `{{template "card" size=1}}`, "[<no value>:1:<no value>]", ""},
+		{"with pipeline", `{{template "card" .Name title=(printf "%s!" .Name)}}`, "[bob!:3:bob]", ""},
+		{"pipeline variables", `{{template "card" $x := 1 size=2}}{{$x}}`, "[<no value>:2:1]1", ""},
+		{"dynamic", `{{template .Kind title=.Name}}`, "[bob:3:<no value>]", ""},
+		{"block", `{{block "inner" title=.Name}}<{{$title}}>{{end}}`, "<bob>", ""},
+		{"unknown", `{{template "card" color=1}}`, "", `template: t:1:89: executing "t" at <1>: template "card" has no parameter color`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := Must(New("t").Parse(text + test.input))
+			var b strings.Builder
+			err := tmpl.Execute(&b, map[string]string{"Name": "bob", "Kind": "card"})
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || err.Error() != test.err):
+				t.Fatalf("expected error %q, got %v", test.err, err)
+			case test.err == "" && b.String() != test.output:
+				t.Errorf("expected %q, got %q", test.output, b.String())
+			}
+			if test.err != "" && !errors.Is(err, ErrUnknownParameter) {
+				t.Errorf("expected %v to be an unknown parameter error", err)
+			}
+		})
+	}
+	if params := Must(New("t").Parse(text)).Lookup("card").GetParams(); !reflect.DeepEqual(params, []string{"title", "size"}) {
+		t.Errorf("unexpected parameters %v", params)
+	}
+}
+
+func TestTry(t *testing.T) {
+	const defines = `{{define "widget"}}widget{{fail}}{{end}}`
+	tests := []struct {
+		name, input, output string
+	}{
+		{"success", `{{try}}a{{.Name}}{{catch $err}}failed{{end}}`, "abob"},
+		{"failure", `<{{try}}partial{{fail}}{{catch $err}}{{$err.Cause}}{{end}}>`, "<error calling fail: bang>"},
+		{"no catch", `<{{try}}partial{{fail}}{{end}}>`, "<>"},
+		{"no variable", `{{try}}{{fail}}{{catch}}caught{{end}}`, "caught"},
+		{"template", `{{try}}{{template "widget"}}{{catch}}caught{{end}}`, "caught"},
+		{"nested", `{{try}}a{{try}}{{fail}}{{catch}}b{{end}}{{fail}}{{catch}}c{{end}}`, "c"},
+		{"break", `{{range .List}}{{try}}{{.}}{{break}}{{end}}{{end}}`, "1"},
+		{"variables", `{{$x := 1}}{{try}}{{$x = 2}}{{$y := 3}}{{end}}{{$x}}`, "2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl := New("t").Option(Trap).Funcs(FuncMap{"fail": func() (string, error) { return "", errors.New("bang") }})
+			tmpl = Must(tmpl.Parse(defines + test.input))
+			var b strings.Builder
+			if err := tmpl.Execute(&b, map[string]interface{}{"Name": "bob", "List": []int{1, 2}}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.String() != test.output {
+				t.Errorf("expected %q, got %q", test.output, b.String())
+			}
+		})
+	}
+
+	// Errors are caught rather than collected.
+	tmpl := New("t").Option(Trap, CollectErrors{Placeholder: "#"}).Funcs(FuncMap{"fail": func() (string, error) { return "", errors.New("bang") }})
+	tmpl = Must(tmpl.Parse(`{{try}}{{fail}}{{catch}}caught{{end}}{{fail}}`))
+	var b strings.Builder
+	var errs ExecErrors
+	if err := tmpl.Execute(&b, nil); !errors.As(err, &errs) || len(errs) != 1 {
+		t.Errorf("expected a single collected error, got %v", err)
+	}
+	if b.String() != "caught#" {
+		t.Errorf("expected %q, got %q", "caught#", b.String())
+	}
+
+	if _, err := New("t").Parse(`{{try}}{{end}}`); err == nil || !strings.Contains(err.Error(), "{{try}} requires the Trap option") {
+		t.Errorf("expected the Trap option to be required, got %v", err)
+	}
+}
+
 func funcNameTestFunc() int {
 	return 0
 }
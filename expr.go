@@ -0,0 +1,313 @@
+package template
+
+import (
+	"math"
+	"reflect"
+
+	"github.com/jocgir/template/parse"
+)
+
+// evalExpr evaluates an arithmetic, comparison or logical operator applied to its operands.
+func (s *state) evalExpr(dot reflect.Value, expr *parse.ExprNode) reflect.Value {
+	s.at(expr)
+	if len(expr.Operands) == 1 {
+		value := indirectInterface(s.evalOperand(dot, expr.Operands[0]))
+		s.at(expr)
+		if expr.Operator == "!" {
+			return reflect.ValueOf(!truth(value))
+		}
+		return s.negate(value)
+	}
+	x := s.evalOperand(dot, expr.Operands[0])
+	switch expr.Operator {
+	case "&&", "||":
+		// Like the and and or functions, the evaluation stops at the first
+		// operand that determines the result, which is returned unchanged.
+		if truth(x) == (expr.Operator == "||") {
+			return x
+		}
+		return s.evalOperand(dot, expr.Operands[1])
+	}
+	y := s.evalOperand(dot, expr.Operands[1])
+	s.at(expr)
+	x, y = indirectInterface(x), indirectInterface(y)
+	if (expr.Operator == "==" || expr.Operator == "!=") && (nilOperand(expr.Operands[0]) || nilOperand(expr.Operands[1])) {
+		// Comparing to nil tells whether the other operand is nil.
+		return reflect.ValueOf(isNilValue(x) && isNilValue(y) == (expr.Operator == "=="))
+	}
+	// Numeric constants take the type of the other operand when they can
+	// represent it, as the untyped constants of Go. Between two constants,
+	// the integer becomes a float and the float a complex.
+	switch cx, cy := constantOperand(expr.Operands[0]), constantOperand(expr.Operands[1]); {
+	case cx != nil && (cy == nil || x.Kind() < y.Kind()):
+		x = convertConstant(cx, x, y)
+	case cy != nil:
+		y = convertConstant(cy, y, x)
+	}
+	var (
+		result bool
+		err    error
+	)
+	switch expr.Operator {
+	case "==":
+		result, err = eq(x, y)
+	case "!=":
+		result, err = ne(x, y)
+	case "<":
+		result, err = lt(x, y)
+	case "<=":
+		result, err = le(x, y)
+	case ">":
+		result, err = gt(x, y)
+	case ">=":
+		result, err = ge(x, y)
+	default:
+		return s.arithmetic(expr.Operator, x, y)
+	}
+	if err != nil {
+		s.failf(ErrBadOperation, "%s: %v", expr.Operator, err)
+	}
+	return reflect.ValueOf(result)
+}
+
+// evalOperand evaluates an operand of an expression.
+func (s *state) evalOperand(dot reflect.Value, node parse.Node) reflect.Value {
+	switch node := node.(type) {
+	case *parse.CommandNode:
+		if nilOperand(node) {
+			return zero
+		}
+		return s.evalCommand(dot, node, missingVal)
+	case *parse.ExprNode:
+		return s.evalExpr(dot, node)
+	}
+	s.failf(ErrUnknownNode, "unknown operand: %s", node)
+	panic("not reached")
+}
+
+// nilOperand reports whether an operand of an expression is the nil constant.
+func nilOperand(operand parse.Node) bool {
+	cmd, ok := operand.(*parse.CommandNode)
+	return ok && len(cmd.Args) == 1 && cmd.Args[0].Type() == parse.NodeNil
+}
+
+// isNilValue reports whether a value is missing or is a nil chan, func, interface, map, pointer or slice.
+func isNilValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+		return value.IsNil()
+	}
+	return false
+}
+
+// constantOperand returns the number constant that is the operand of an
+// expression, nil if the operand is not a constant.
+func constantOperand(operand parse.Node) *parse.NumberNode {
+	if cmd, ok := operand.(*parse.CommandNode); ok && len(cmd.Args) == 1 {
+		constant, _ := cmd.Args[0].(*parse.NumberNode)
+		return constant
+	}
+	return nil
+}
+
+// convertConstant returns the value of a number constant converted to the type
+// of the other operand if it can be represented by this type, the value given
+// by idealConstant otherwise.
+func convertConstant(constant *parse.NumberNode, value, other reflect.Value) reflect.Value {
+	if !other.IsValid() {
+		return value
+	}
+	kind, _ := basicKind(other)
+	result := reflect.New(other.Type()).Elem()
+	switch {
+	case kind == intKind && constant.IsInt && !result.OverflowInt(constant.Int64):
+		result.SetInt(constant.Int64)
+	case kind == uintKind && constant.IsUint && !result.OverflowUint(constant.Uint64):
+		result.SetUint(constant.Uint64)
+	case kind == floatKind && constant.IsFloat:
+		result.SetFloat(constant.Float64)
+	case kind == complexKind && constant.IsComplex:
+		result.SetComplex(constant.Complex128)
+	default:
+		return value
+	}
+	return result
+}
+
+// negate returns the opposite of a number.
+func (s *state) negate(value reflect.Value) reflect.Value {
+	kind, _ := basicKind(value)
+	if kind != intKind && kind != uintKind && kind != floatKind && kind != complexKind {
+		s.failf(ErrBadOperation, "can't negate %s", typeName(value))
+	}
+	result := reflect.New(value.Type()).Elem()
+	switch kind {
+	case intKind:
+		if value.Int() == math.MinInt64 || result.OverflowInt(-value.Int()) {
+			s.failf(ErrBadOperation, "integer overflow: -%d overflows %s", value.Int(), value.Type())
+		}
+		result.SetInt(-value.Int())
+	case uintKind:
+		if value.Uint() != 0 {
+			s.failf(ErrBadOperation, "integer overflow: -%d overflows %s", value.Uint(), value.Type())
+		}
+	case floatKind:
+		result.SetFloat(-value.Float())
+	case complexKind:
+		result.SetComplex(-value.Complex())
+	}
+	return result
+}
+
+// arithmetic applies an arithmetic operator to numbers of the same kind, or to
+// an integer and an unsigned integer as the comparison functions do. + also
+// concatenates strings. The result has the type of the operands if they have
+// the same type, the basic type of their kind otherwise.
+func (s *state) arithmetic(operator string, x, y reflect.Value) reflect.Value {
+	kx, errX := basicKind(x)
+	ky, errY := basicKind(y)
+	if errX != nil || errY != nil || kx == boolKind {
+		s.failf(ErrBadOperation, "invalid operation: %s %s %s", typeName(x), operator, typeName(y))
+	}
+	var result reflect.Value
+	if x.Type() == y.Type() {
+		result = reflect.New(x.Type()).Elem()
+	}
+	if kx != ky {
+		if !(kx == intKind && ky == uintKind || kx == uintKind && ky == intKind) {
+			s.failf(ErrBadOperation, "incompatible types for %s: %s and %s", operator, x.Type(), y.Type())
+		}
+		// The unsigned integer is used as an integer.
+		x, y = s.signed(x), s.signed(y)
+		kx = intKind
+	}
+	switch kx {
+	case intKind:
+		if result == zero {
+			result = reflect.New(reflect.TypeOf(0)).Elem()
+		}
+		a, b := x.Int(), y.Int()
+		var c int64
+		overflow := false
+		switch operator {
+		case "+":
+			c = a + b
+			overflow = (c > a) != (b > 0)
+		case "-":
+			c = a - b
+			overflow = (c < a) != (b > 0)
+		case "*":
+			c = a * b
+			overflow = a != 0 && (c/a != b || a == -1 && b == math.MinInt64)
+		case "/", "%":
+			if b == 0 {
+				s.failf(ErrBadOperation, "integer divide by zero")
+			}
+			if operator == "/" {
+				c = a / b
+				overflow = a == math.MinInt64 && b == -1
+			} else {
+				c = a % b
+			}
+		}
+		if overflow || result.OverflowInt(c) {
+			s.failf(ErrBadOperation, "integer overflow: %d %s %d overflows %s", a, operator, b, result.Type())
+		}
+		result.SetInt(c)
+	case uintKind:
+		if result == zero {
+			result = reflect.New(reflect.TypeOf(uint(0))).Elem()
+		}
+		a, b := x.Uint(), y.Uint()
+		var c uint64
+		overflow := false
+		switch operator {
+		case "+":
+			c = a + b
+			overflow = c < a
+		case "-":
+			c = a - b
+			overflow = b > a
+		case "*":
+			c = a * b
+			overflow = a != 0 && c/a != b
+		case "/", "%":
+			if b == 0 {
+				s.failf(ErrBadOperation, "integer divide by zero")
+			}
+			if operator == "/" {
+				c = a / b
+			} else {
+				c = a % b
+			}
+		}
+		if overflow || result.OverflowUint(c) {
+			s.failf(ErrBadOperation, "integer overflow: %d %s %d overflows %s", a, operator, b, result.Type())
+		}
+		result.SetUint(c)
+	case floatKind:
+		if result == zero {
+			result = reflect.New(reflect.TypeOf(0.0)).Elem()
+		}
+		a, b := x.Float(), y.Float()
+		switch operator {
+		case "+":
+			result.SetFloat(a + b)
+		case "-":
+			result.SetFloat(a - b)
+		case "*":
+			result.SetFloat(a * b)
+		case "/":
+			result.SetFloat(a / b)
+		default:
+			s.failf(ErrBadOperation, "operator %s not defined on %s", operator, x.Type())
+		}
+	case complexKind:
+		if result == zero {
+			result = reflect.New(reflect.TypeOf(0i)).Elem()
+		}
+		a, b := x.Complex(), y.Complex()
+		switch operator {
+		case "+":
+			result.SetComplex(a + b)
+		case "-":
+			result.SetComplex(a - b)
+		case "*":
+			result.SetComplex(a * b)
+		case "/":
+			result.SetComplex(a / b)
+		default:
+			s.failf(ErrBadOperation, "operator %s not defined on %s", operator, x.Type())
+		}
+	case stringKind:
+		if operator != "+" {
+			s.failf(ErrBadOperation, "operator %s not defined on %s", operator, x.Type())
+		}
+		if result == zero {
+			result = reflect.New(reflect.TypeOf("")).Elem()
+		}
+		result.SetString(x.String() + y.String())
+	}
+	return result
+}
+
+// signed returns an integer value as an int64, failing if an unsigned value overflows it.
+func (s *state) signed(value reflect.Value) reflect.Value {
+	if value.Kind() >= reflect.Uint && value.Kind() <= reflect.Uintptr {
+		if value.Uint() > math.MaxInt64 {
+			s.failf(ErrBadOperation, "%d overflows int64", value.Uint())
+		}
+		return reflect.ValueOf(int64(value.Uint()))
+	}
+	return reflect.ValueOf(value.Int())
+}
+
+// typeName returns the type of a value, nil for the invalid value.
+func typeName(value reflect.Value) string {
+	if !value.IsValid() {
+		return "nil"
+	}
+	return value.Type().String()
+}
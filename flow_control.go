@@ -31,36 +31,94 @@ func (fc flowControl) String() string {
 	}
 }
 
+// loopControl is raised by {{break}} and {{continue}} to exit the given number of enclosing ranges.
+type loopControl struct {
+	flow   flowControl
+	levels int
+}
+
+func (lc loopControl) Error() string { return lc.flow.String() }
+
+// flow runs one iteration of a range and returns the loop control that interrupted it, if any.
+// Loop controls that must exit more than one range are propagated to the enclosing range.
 func flow(action func()) (result flowControl) {
 	defer func() {
 		switch rec := recover().(type) {
 		case nil:
-		case flowControl:
-			if rec == fcReturn {
+		case loopControl:
+			if rec.levels > 1 {
+				rec.levels--
 				panic(rec)
 			}
-			result = rec
+			result = rec.flow
 		default:
 			panic(rec)
 		}
-
 	}()
 	action()
 	return
 }
 
-func flowReturnValues(context *Context) interface{} {
-	args := context.EvalArgs()
-	if len(args) > 0 {
-		if buffer, isBuffer := context.state.wr.(*bytes.Buffer); isBuffer {
-			buffer.Reset()
+// walkTemplateRoot walks the root of the template being executed until its end or
+// until {{return}} is invoked. It returns the value supplied to {{return}}, if any.
+func (s *state) walkTemplateRoot(dot reflect.Value) (result reflect.Value, returned bool) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			if rec != fcReturn {
+				panic(rec)
+			}
+			if s.returned != nil {
+				result, returned, s.returned = *s.returned, true, nil
+			}
 		}
+	}()
+	if s.tmpl.Extends != "" {
+		s.extend()
+	}
+	s.walk(dot, s.tmpl.Root)
+	return
+}
+
+func flowReturnValues(context *Context) interface{} {
+	if args := context.EvalArgs(); len(args) > 0 {
 		value := reflect.ValueOf(convertResult(args))
-		context.state.printValue(context.Template().Root, value)
+		context.state.returned = &value
 	}
 	panic(fcReturn)
 }
 
+// flowInclude executes the template named by its first argument, using its second
+// argument, if any, as dot. Instead of printing the result, it returns the value
+// supplied to {{return}} or the text generated by the template.
+func flowInclude(context *Context) interface{} {
+	s := context.state
+	var dot reflect.Value
+	switch context.ArgCount() {
+	case 1:
+	case 2:
+		dot = reflect.ValueOf(context.Arg(1))
+	default:
+		s.failf(ErrWrongArgCount, "wrong number of args for %s: want 1 or 2 got %d", context.MemberName(), context.ArgCount())
+	}
+	name, isString := context.Arg(0).(string)
+	if !isString {
+		s.failf(ErrWrongType, "template name must be a string, got %T", context.Arg(0))
+	}
+	tmpl := s.tmpl.tmpl[name]
+	if tmpl == nil {
+		s.failf(ErrUndefinedTemplate, "template %q not defined", name)
+	}
+	s.checkDepth()
+	var buffer bytes.Buffer
+	if result, returned := s.callTemplate(tmpl, dot, nil, &buffer); returned {
+		if !result.IsValid() {
+			return nil
+		}
+		return result.Interface()
+	}
+	return buffer.String()
+}
+
 func convertResult(result []interface{}) interface{} {
 	switch len(result) {
 	case 0:
@@ -62,3 +62,77 @@ func Test_flow_control(t *testing.T) {
 		})
 	}
 }
+
+func Test_loop_control(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		code   string
+		wanted string
+	}{
+		{"Break", `{{ range . }}{{ if eq . 3 }}{{ break }}{{ end }}{{ . }}{{ end }}`, "12"},
+		{"Continue", `{{ range . }}{{ if eq . 3 }}{{ continue }}{{ end }}{{ . }}{{ end }}`, "1245"},
+		{"Break inner", `{{ range $i := . }}{{ range $ }}{{ if gt . $i }}{{ break }}{{ end }}{{ . }}{{ end }};{{ end }}`, "1;12;123;1234;12345;"},
+		{"Break 2", `{{ range $i := . }}{{ range $ }}{{ if and (eq $i 2) (eq . 3) }}{{ break 2 }}{{ end }}{{ . }}{{ end }};{{ end }}`, "12345;12"},
+		{"Continue 2", `{{ range $i := . }}{{ range $ }}{{ if gt . $i }}{{ continue 2 }}{{ end }}{{ . }}{{ end }};{{ end }}`, "112123123412345;"},
+		{"Break map", `{{ range $k, $v := dict }}{{ if eq $k "c" }}{{ break }}{{ end }}{{ $k }}{{ end }}`, "ab"},
+		{"Break after else", `{{ range . }}{{ range slice $ 0 0 }}{{ else }}{{ break }}{{ end }}x{{ end }}`, ""},
+	}
+	funcs := FuncMap{"dict": func() map[string]int { return map[string]int{"a": 1, "b": 2, "c": 3, "d": 4} }}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tmpl := Must(New("test").Funcs(funcs).Parse(tt.code))
+			assert.NoError(t, tmpl.Execute(&buffer, []int{1, 2, 3, 4, 5}))
+			assert.Equal(t, tt.wanted, buffer.String())
+		})
+	}
+}
+
+func Test_template_return(t *testing.T) {
+	t.Parallel()
+
+	const defines = `
+		{{- define "calc" }}{{ return (add .A .B) }}{{ end -}}
+		{{- define "list" }}{{ return .A .B }}{{ end -}}
+		{{- define "text" }}Hello {{ . }}{{ end -}}
+		{{- define "early" }}a{{ if . }}{{ return }}{{ end }}b{{ end -}}
+		{{- define "nil" }}{{ return nil }}{{ end -}}`
+
+	tests := []struct {
+		name   string
+		code   string
+		wanted string
+		err    string
+	}{
+		{"Typed value", `{{ $v := include "calc" . }}{{ printf "%T %v" $v $v }}`, "int 5", ""},
+		{"Used as argument", `{{ add (include "calc" .) 1 }}`, "6", ""},
+		{"Multiple values", `{{ $v := include "list" . }}{{ index $v 1 }}`, "3", ""},
+		{"Output as value", `{{ $v := include "text" "world" }}[{{ $v }}]`, "[Hello world]", ""},
+		{"Output before return", `{{ include "early" true }}-{{ include "early" false }}`, "a-ab", ""},
+		{"Nil value", `{{ $v := include "nil" }}{{ printf "%v" $v }}`, "<nil>", ""},
+		{"Template prints value", `x{{ template "calc" . }}y`, "x5y", ""},
+		{"Template stops", `x{{ template "early" true }}y`, "xay", ""},
+		{"Top level return", `x{{ return "Value" }}y`, "Value", ""},
+		{"Undefined", `{{ include "missing" }}`, "", `template "missing" not defined`},
+		{"Bad name", `{{ include 1 }}`, "", "template name must be a string, got int"},
+		{"Too many args", `{{ include "calc" . . }}`, "", "wrong number of args for include: want 1 or 2 got 3"},
+	}
+	funcs := FuncMap{"add": func(a, b int) int { return a + b }}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			tmpl := Must(New("test").Option(FlowControl).Funcs(funcs).Parse(defines + tt.code))
+			err := tmpl.Execute(&buffer, map[string]int{"A": 2, "B": 3})
+			if tt.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wanted, buffer.String())
+		})
+	}
+}
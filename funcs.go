@@ -346,6 +346,10 @@ func call(fn reflect.Value, args ...reflect.Value) (reflect.Value, error) {
 func safeCall(fun reflect.Value, args []reflect.Value) (val reflect.Value, err error) {
 	defer func() {
 		if r := recover(); r != nil {
+			if _, isExecError := r.(ExecError); isExecError {
+				// Raised while evaluating a Lazy argument.
+				panic(r)
+			}
 			if e, ok := r.(error); ok {
 				err = e
 			} else {
@@ -369,32 +373,36 @@ func truth(arg reflect.Value) bool {
 
 // and computes the Boolean AND of its arguments, returning
 // the first false argument it encounters, or the last argument.
-func and(arg0 reflect.Value, args ...reflect.Value) reflect.Value {
-	if !truth(arg0) {
-		return arg0
+// The arguments following the first false one are not evaluated.
+func and(arg0 Lazy, args ...Lazy) reflect.Value {
+	value := arg0()
+	if !truth(value) {
+		return value
 	}
 	for i := range args {
-		arg0 = args[i]
-		if !truth(arg0) {
+		value = args[i]()
+		if !truth(value) {
 			break
 		}
 	}
-	return arg0
+	return value
 }
 
 // or computes the Boolean OR of its arguments, returning
 // the first true argument it encounters, or the last argument.
-func or(arg0 reflect.Value, args ...reflect.Value) reflect.Value {
-	if truth(arg0) {
-		return arg0
+// The arguments following the first true one are not evaluated.
+func or(arg0 Lazy, args ...Lazy) reflect.Value {
+	value := arg0()
+	if truth(value) {
+		return value
 	}
 	for i := range args {
-		arg0 = args[i]
-		if truth(arg0) {
+		value = args[i]()
+		if truth(value) {
 			break
 		}
 	}
-	return arg0
+	return value
 }
 
 // not returns the Boolean negation of its argument.
@@ -0,0 +1,84 @@
+package template
+
+import (
+	"reflect"
+
+	"github.com/jocgir/template/parse"
+)
+
+// extend replaces the template being executed by the layout it extends, directly
+// or through other extending templates, and records the templates whose blocks
+// override the ones of the layout.
+func (s *state) extend() {
+	var layout []*Template
+	for s.tmpl.Extends != "" {
+		for _, extending := range layout {
+			if extending.Tree == s.tmpl.Tree {
+				s.failf(ErrBadLayout, "template %q extends itself", s.tmpl.Name())
+			}
+		}
+		layout = append(layout, s.tmpl)
+		base := s.tmpl.tmpl[s.tmpl.Extends]
+		if base == nil || base.Tree == nil {
+			s.failf(ErrUndefinedTemplate, "template %q extended by %q not defined", s.tmpl.Extends, s.tmpl.Name())
+		}
+		s.tmpl = base
+	}
+	s.layout = layout
+}
+
+// override returns the most derived definition of the named block, starting at
+// the given level of the layout, nil if the block is not overridden.
+func (s *state) override(name string, level int) *Template {
+	for _, extending := range s.layout[level:] {
+		if tree := extending.Blocks[name]; tree != nil {
+			return extending.block(name, tree)
+		}
+	}
+	return nil
+}
+
+// walkSuper executes the definition of the current block that is overridden by
+// the one being executed.
+func (s *state) walkSuper(node *parse.SuperNode) {
+	s.at(node)
+	name := s.tmpl.Name()
+	level := -1
+	for i, extending := range s.layout {
+		if extending.Blocks[name] == s.tmpl.Tree {
+			level = i
+			break
+		}
+	}
+	if level < 0 {
+		s.failf(ErrBadLayout, "{{super}} outside an overriding block")
+	}
+	tmpl := s.override(name, level+1)
+	if tmpl == nil {
+		if tmpl = s.tmpl.tmpl[name]; tmpl == nil || tmpl.Tree == nil {
+			s.failf(ErrUndefinedTemplate, "block %q not defined by the extended templates", name)
+		}
+	}
+	s.checkDepth()
+	// The overridden block is executed with the same dot and arguments.
+	args := make(map[string]reflect.Value, len(s.tmpl.Params))
+	for _, param := range s.tmpl.Params {
+		args[param.Name] = s.varValue("$" + param.Name)
+	}
+	if result, returned := s.callLayout(tmpl, s.layout, s.vars[0].value, args, s.wr); returned {
+		s.printValue(node, result)
+	}
+}
+
+// block returns a template executing the tree of a block overridden by t.
+// It is not associated with t, so the blocks of templates extending the same
+// layout do not clobber each other.
+func (t *Template) block(name string, tree *parse.Tree) *Template {
+	return &Template{
+		name:       name,
+		Tree:       tree,
+		common:     t.common,
+		leftDelim:  t.leftDelim,
+		rightDelim: t.rightDelim,
+	}
+}
@@ -0,0 +1,68 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtends(t *testing.T) {
+	t.Parallel()
+
+	templates := map[string]string{
+		"base":    `<{{ block "title" . }}Base{{ end }}|{{ block "body" . }}{{ . }}{{ end }}>`,
+		"report":  `{{ extends "base" }}{{ block "title" . }}Report {{ super }}{{ end }}`,
+		"summary": `{{ extends "report" }}{{ block "title" . }}Summary/{{ super }}{{ end }}{{ block "body" . }}[{{ super }}]{{ end }}`,
+		"detail":  `{{ extends "report" }}{{ block "body" . }}{{ range . }}{{ block "line" . }}-{{ . }}{{ end }}{{ end }}{{ end }}`,
+		"invoke":  `{{ extends "base" }}{{ block "body" . }}{{ template "detail" . }}{{ end }}`,
+		"params":  `{{ define "greet" }}{{ block "name" . who="you" }}{{ $who }}{{ end }}{{ end }}{{ extends "greet" }}{{ block "name" . who="" }}dear {{ super }}{{ end }}`,
+		"nested":  `{{ extends "base" }}{{ block "body" . }}child[{{ template "base" . }}]{{ end }}`,
+		"self":    `{{ extends "self" }}`,
+		"loop1":   `{{ extends "loop2" }}`,
+		"loop2":   `{{ extends "loop1" }}`,
+		"missing": `{{ extends "undefined" }}`,
+	}
+	tmpl := New("root")
+	for name, text := range templates {
+		Must(tmpl.New(name).Parse(text))
+	}
+
+	tests := []struct {
+		name   string
+		data   interface{}
+		result string
+		err    error
+	}{
+		{"base", "x", "<Base|x>", nil},
+		{"report", "x", "<Report Base|x>", nil},
+		{"summary", "x", "<Summary/Report Base|[x]>", nil},
+		{"detail", []int{1, 2}, "<Report Base|-1-2>", nil},
+		{"invoke", []int{1}, "<Base|<Report Base|-1>>", nil},
+		{"params", nil, "dear you", nil},
+		{"nested", "x", "<Base|child[<Base|x>]>", nil},
+		{"self", nil, "", ErrBadLayout},
+		{"loop1", nil, "", ErrBadLayout},
+		{"missing", nil, "", ErrUndefinedTemplate},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buffer bytes.Buffer
+			err := tmpl.ExecuteTemplate(&buffer, tt.name, tt.data)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "%v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.result, buffer.String())
+		})
+	}
+
+	// The blocks of the extending templates are not associated with the set.
+	assert.Nil(t, tmpl.Lookup("line"))
+	assert.Equal(t, "Base", tmpl.Lookup("title").Root.String())
+}
@@ -0,0 +1,44 @@
+package template
+
+import (
+	"reflect"
+
+	"github.com/jocgir/template/parse"
+)
+
+// Lazy is the type of a function parameter that receives its argument unevaluated.
+// The argument is evaluated the first time the Lazy is called; it must not be
+// called once the function has returned.
+//
+// A piped argument is always evaluated before the function is called.
+//
+//   t.Funcs(template.FuncMap{
+//     "default": func(value template.Lazy, fallback interface{}) interface{} {
+//       if v := value(); v.IsValid() {
+//         return v.Interface()
+//       }
+//       return fallback
+//     },
+//   })
+type Lazy func() reflect.Value
+
+var lazyType = reflect.TypeOf(Lazy(nil))
+
+// lazyArg returns a Lazy that evaluates the argument n on demand.
+func (s *state) lazyArg(dot reflect.Value, n parse.Node) reflect.Value {
+	var (
+		value     reflect.Value
+		evaluated bool
+	)
+	return reflect.ValueOf(Lazy(func() reflect.Value {
+		if !evaluated {
+			value, evaluated = s.evalArg(dot, reflectValueType, n).Interface().(reflect.Value), true
+		}
+		return value
+	}))
+}
+
+// lazyValue returns a Lazy that returns an already evaluated value.
+func lazyValue(value reflect.Value) reflect.Value {
+	return reflect.ValueOf(Lazy(func() reflect.Value { return value }))
+}
@@ -0,0 +1,66 @@
+package template
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazy(t *testing.T) {
+	t.Parallel()
+
+	type data struct {
+		Ptr   *struct{ Field string }
+		Count int
+	}
+	var calls int
+	funcs := FuncMap{
+		"count": func() int { calls++; return calls },
+		"fail":  func() (bool, error) { panic("must not be called") },
+		"default": func(value Lazy, fallback interface{}) interface{} {
+			if v := value(); v.IsValid() && !v.IsZero() {
+				return v.Interface()
+			}
+			return fallback
+		},
+		"twice": func(value Lazy) int { return value().Interface().(int) + value().Interface().(int) },
+	}
+	tests := []struct {
+		name   string
+		input  string
+		data   interface{}
+		result string
+		err    string
+	}{
+		{"And short-circuit on nil", `{{if and .Ptr .Ptr.Field}}set{{else}}unset{{end}}`, data{}, "unset", ""},
+		{"Or short-circuit", `{{or 1 fail}}`, nil, "1", ""},
+		{"And short-circuit", `{{and 0 fail}}`, nil, "0", ""},
+		{"And last value", `{{and 1 "a" 2}}`, nil, "2", ""},
+		{"Or last value", `{{or 0 "" nil}}`, nil, "<no value>", ""},
+		{"Piped argument", `{{0 | or 1}}`, nil, "1", ""},
+		{"Piped argument evaluated last", `{{3 | and 1 2}}`, nil, "3", ""},
+		{"Error in lazy argument", `{{and 1 .Missing}}`, 1, "", `template: t:1:8: executing "t" at <.Missing>: can't evaluate field Missing in type int`},
+		{"User lazy function", `{{default .Count "none"}}`, data{}, "none", ""},
+		{"User lazy function with value", `{{default .Count "none"}}`, data{Count: 2}, "2", ""},
+		{"Evaluated once", `{{twice count}}`, nil, "2", ""},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl := Must(New("t").Funcs(funcs).Parse(tc.input))
+
+			buffer := new(bytes.Buffer)
+			err := tmpl.Execute(buffer, tc.data)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, buffer.String())
+			assert.NoError(t, tmpl.Check(reflect.TypeOf(tc.data)))
+		})
+	}
+}
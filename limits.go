@@ -0,0 +1,131 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Limits defines the execution budgets enforced while executing a template.
+// A zero value for any field means that the corresponding budget is not enforced
+// (except for MaxDepth that defaults to the package maximum template depth).
+//
+// Limits are set through the Option method:
+//   template.New("name").Option(template.Limits{MaxSteps: 10000, MaxOutput: 1 << 20})
+type Limits struct {
+	MaxDepth      int // Maximum depth of nested {{template}} invocations.
+	MaxSteps      int // Maximum number of evaluated nodes (actions, commands and arguments).
+	MaxIterations int // Maximum number of range iterations over the whole execution.
+	MaxOutput     int // Maximum number of bytes written to the output.
+}
+
+// LimitKind identifies an execution budget.
+type LimitKind uint8
+
+const (
+	// DepthLimit identifies the maximum nested template depth.
+	DepthLimit LimitKind = iota
+	// StepsLimit identifies the maximum number of evaluated nodes.
+	StepsLimit
+	// IterationsLimit identifies the maximum number of range iterations.
+	IterationsLimit
+	// OutputLimit identifies the maximum number of bytes written to the output.
+	OutputLimit
+)
+
+func (k LimitKind) String() string {
+	switch k {
+	case DepthLimit:
+		return "template depth"
+	case StepsLimit:
+		return "evaluation steps"
+	case IterationsLimit:
+		return "range iterations"
+	case OutputLimit:
+		return "output bytes"
+	}
+	return "Undefined"
+}
+
+// LimitError is the error wrapped into ExecError when an execution budget is exceeded.
+// It can be retrieved with errors.As.
+type LimitError struct {
+	Kind LimitKind // The exceeded budget.
+	Max  int       // The configured maximum.
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("exceeded maximum %s (%d)", e.Kind, e.Max)
+}
+
+// budget holds the limits and the consumption of an execution.
+// It is shared by all states of a single execution.
+type budget struct {
+	Limits
+	steps      int
+	iterations int
+	output     int
+}
+
+func newBudget(limits Limits) *budget {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = maxExecDepth
+	}
+	return &budget{Limits: limits}
+}
+
+// exceeded terminates processing with a LimitError.
+func (s *state) exceeded(kind LimitKind, max int) {
+	s.errorf("%w", &LimitError{kind, max})
+}
+
+// checkDepth ensures that invoking another template does not exceed the maximum depth.
+func (s *state) checkDepth() {
+	if s.depth >= s.budget.MaxDepth {
+		s.exceeded(DepthLimit, s.budget.MaxDepth)
+	}
+}
+
+// step accounts for the evaluation of a node.
+func (s *state) step() {
+	if b := s.budget; b.MaxSteps > 0 {
+		if b.steps++; b.steps > b.MaxSteps {
+			s.exceeded(StepsLimit, b.MaxSteps)
+		}
+	}
+}
+
+// iterate accounts for a range iteration.
+func (s *state) iterate() {
+	if b := s.budget; b.MaxIterations > 0 {
+		if b.iterations++; b.iterations > b.MaxIterations {
+			s.exceeded(IterationsLimit, b.MaxIterations)
+		}
+	}
+}
+
+// output returns the writer used to produce the template output.
+func (s *state) output() io.Writer {
+	if s.budget.MaxOutput > 0 {
+		return budgetWriter{s}
+	}
+	return s.wr
+}
+
+// budgetWriter ensures that nothing is written beyond the output budget.
+type budgetWriter struct{ s *state }
+
+func (w budgetWriter) Write(p []byte) (int, error) {
+	b := w.s.budget
+	if b.output+len(p) > b.MaxOutput {
+		w.s.exceeded(OutputLimit, b.MaxOutput)
+	}
+	b.output += len(p)
+	return w.s.wr.Write(p)
+}
+
+// isLimitError reports whether the error results from an exceeded budget.
+func isLimitError(err error) bool {
+	var limitError *LimitError
+	return errors.As(err, &limitError)
+}
@@ -0,0 +1,132 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		input  string
+		data   interface{}
+		limits Limits
+		result string
+		kind   LimitKind
+		err    string
+	}{
+		{
+			name:   "No limit",
+			input:  `{{range .}}{{.}}{{end}}`,
+			data:   []int{1, 2, 3},
+			result: "123",
+		},
+		{
+			name:   "Depth within limit",
+			input:  `{{define "a"}}a{{template "b"}}{{end}}{{define "b"}}b{{end}}{{template "a"}}`,
+			limits: Limits{MaxDepth: 2},
+			result: "ab",
+		},
+		{
+			name:   "Depth exceeded",
+			input:  `{{define "a"}}a{{template "b"}}{{end}}{{define "b"}}b{{end}}{{template "a"}}`,
+			limits: Limits{MaxDepth: 1},
+			kind:   DepthLimit,
+			err:    `template: t:1:26: executing "a" at <{{template "b"}}>: exceeded maximum template depth (1)`,
+		},
+		{
+			name:   "Depth exceeded through eval",
+			input:  `{{define "b"}}b{{end}}{{eval "{{template \"b\"}}"}}`,
+			limits: Limits{MaxDepth: 1},
+			kind:   DepthLimit,
+			err:    `template: eval:1:11: executing "eval" at <{{template "b"}}>: exceeded maximum template depth (1)`,
+		},
+		{
+			name:   "Steps within limit",
+			input:  `{{range .}}{{.}}{{end}}`,
+			data:   []int{1, 2, 3},
+			limits: Limits{MaxSteps: 12},
+			result: "123",
+		},
+		{
+			name:   "Steps exceeded",
+			input:  `{{range .}}{{.}}{{end}}`,
+			data:   []int{1, 2, 3},
+			limits: Limits{MaxSteps: 11},
+			kind:   StepsLimit,
+			err:    `template: t:1:13: executing "t" at <.>: exceeded maximum evaluation steps (11)`,
+		},
+		{
+			name:   "Iterations within limit",
+			input:  `{{range .}}{{range .}}{{.}}{{end}}{{end}}`,
+			data:   [][]int{{1, 2}, {3}},
+			limits: Limits{MaxIterations: 5},
+			result: "123",
+		},
+		{
+			name:   "Iterations exceeded",
+			input:  `{{range .}}{{range .}}{{.}}{{end}}{{end}}`,
+			data:   [][]int{{1, 2}, {3}},
+			limits: Limits{MaxIterations: 4},
+			kind:   IterationsLimit,
+			err:    `template: t:1:19: executing "t" at <.>: exceeded maximum range iterations (4)`,
+		},
+		{
+			name:   "Output within limit",
+			input:  `Hello {{.}}!`,
+			data:   "world",
+			limits: Limits{MaxOutput: 12},
+			result: "Hello world!",
+		},
+		{
+			name:   "Output exceeded by value",
+			input:  `Hello {{.}}!`,
+			data:   "world",
+			limits: Limits{MaxOutput: 10},
+			kind:   OutputLimit,
+			err:    `template: t:1:8: executing "t" at <{{.}}>: exceeded maximum output bytes (10)`,
+		},
+		{
+			name:   "Output exceeded by text",
+			input:  `Hello {{.}}!`,
+			data:   "world",
+			limits: Limits{MaxOutput: 11},
+			kind:   OutputLimit,
+			err:    `template: t:1:11: executing "t" at <!>: exceeded maximum output bytes (11)`,
+		},
+		{
+			name:   "Limit within trapped call",
+			input:  `{{trap (len .)}}`,
+			data:   []int{1, 2, 3},
+			limits: Limits{MaxSteps: 5},
+			kind:   StepsLimit,
+			err:    `template: t:1:12: executing "t" at <.>: exceeded maximum evaluation steps (5)`,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := Must(New("t").Option(AllOptions, tc.limits).Parse(tc.input))
+
+			buffer := new(bytes.Buffer)
+			err := tmpl.Execute(buffer, tc.data)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				var limitError *LimitError
+				if assert.True(t, errors.As(err, &limitError)) {
+					assert.Equal(t, tc.kind, limitError.Kind)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, buffer.String())
+		})
+	}
+}
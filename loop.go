@@ -0,0 +1,62 @@
+package template
+
+import "reflect"
+
+// loopVariable is the name of the variable describing the current iteration of a {{range}}.
+const loopVariable = "$loop"
+
+// Loop describes the current iteration of a {{range}}. It is available in the
+// body of the range through the $loop variable:
+//   {{range .}}{{if not $loop.First}}, {{end}}{{.}}{{end}}
+type Loop struct {
+	Index  int   // Index of the iteration, starting at 0.
+	Number int   // Index of the iteration, starting at 1.
+	First  bool  // Whether this is the first iteration.
+	Last   bool  // Whether this is the last iteration, always false if the length is unknown.
+	Length int   // Number of iterations, -1 if unknown (iteration over a channel).
+	Parent *Loop // Iteration of the enclosing {{range}}, nil if there is none.
+}
+
+// newLoop returns the description of the i-th iteration over length elements.
+func newLoop(parent *Loop, i, length int) *Loop {
+	return &Loop{
+		Index:  i,
+		Number: i + 1,
+		First:  i == 0,
+		Last:   i == length-1,
+		Length: length,
+		Parent: parent,
+	}
+}
+
+// Even returns true if the 1-based index of the iteration is even.
+func (l *Loop) Even() bool { return l.Number%2 == 0 }
+
+// Odd returns true if the 1-based index of the iteration is odd.
+func (l *Loop) Odd() bool { return l.Number%2 == 1 }
+
+// Remaining returns the number of iterations after this one, -1 if the length is unknown.
+func (l *Loop) Remaining() int {
+	if l.Length < 0 {
+		return -1
+	}
+	return l.Length - l.Number
+}
+
+var loopType = reflect.TypeOf((*Loop)(nil))
+
+// isImplicitLoop returns true if the value is the one of a $loop declared by a {{range}}.
+func isImplicitLoop(value reflect.Value) bool { return !value.IsValid() || value.Type() == loopType }
+
+// currentLoop returns the iteration of the innermost {{range}} being executed, nil if there is none.
+// The $loop of a range whose else list is being executed has no value and is skipped.
+func (s *state) currentLoop() *Loop {
+	for i := s.mark() - 1; i >= 0; i-- {
+		if s.vars[i].name == loopVariable && s.vars[i].value.IsValid() {
+			if loop, ok := s.vars[i].value.Interface().(*Loop); ok {
+				return loop
+			}
+		}
+	}
+	return nil
+}
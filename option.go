@@ -18,7 +18,13 @@ const (
 )
 
 type option struct {
-	missingKey missingKeyAction
+	missingKey   missingKeyAction
+	limits       Limits
+	sandbox      *Sandbox
+	collect      *CollectErrors
+	tracer       Tracer
+	debugger     *Debugger
+	dynamicScope bool
 }
 
 // OptionDeprecated sets options for the template. Options are described by
@@ -50,6 +50,7 @@ const (
 	itemLeftDelim  // left action delimiter
 	itemLeftParen  // '(' inside action
 	itemNumber     // simple number, including imaginary
+	itemOperator   // arithmetic, comparison or logical operator
 	itemPipe       // pipe symbol
 	itemRawString  // raw quoted string (includes quotes)
 	itemRightDelim // right action delimiter
@@ -61,30 +62,54 @@ const (
 	// Keywords appear after all the rest.
 	itemKeyword  // used only to delimit the keywords
 	itemBlock    // block keyword
+	itemBreak    // break keyword
+	itemCapture  // capture keyword
+	itemCase     // case keyword
+	itemCatch    // catch keyword
+	itemContinue // continue keyword
 	itemDot      // the cursor, spelled '.'
+	itemDefault  // default keyword
 	itemDefine   // define keyword
 	itemElse     // else keyword
 	itemEnd      // end keyword
+	itemExtends  // extends keyword
 	itemIf       // if keyword
 	itemNil      // the untyped nil constant, easiest to treat as a keyword
 	itemRange    // range keyword
+	itemSuper    // super keyword
+	itemSwitch   // switch keyword
 	itemTemplate // template keyword
+	itemTry      // try keyword
 	itemWith     // with keyword
 )
 
 var key = map[string]itemType{
 	".":        itemDot,
 	"block":    itemBlock,
+	"break":    itemBreak,
+	"capture":  itemCapture,
+	"case":     itemCase,
+	"catch":    itemCatch,
+	"continue": itemContinue,
+	"default":  itemDefault,
 	"define":   itemDefine,
 	"else":     itemElse,
 	"end":      itemEnd,
+	"extends":  itemExtends,
 	"if":       itemIf,
 	"range":    itemRange,
 	"nil":      itemNil,
+	"super":    itemSuper,
+	"switch":   itemSwitch,
 	"template": itemTemplate,
+	"try":      itemTry,
 	"with":     itemWith,
 }
 
+// optionalKeywords are lexed as identifiers if functions with the same names are
+// defined, so that the templates using these functions keep working.
+var optionalKeywords = []string{"break", "capture", "case", "catch", "continue", "default", "extends", "super", "switch", "try"}
+
 const eof = -1
 
 // Trimming spaces.
@@ -107,18 +132,21 @@ type stateFn func(*lexer) stateFn
 
 // lexer holds the state of the scanner.
 type lexer struct {
-	name           string    // the name of the input; used only for error reports
-	input          string    // the string being scanned
-	leftDelim      string    // start of action
-	rightDelim     string    // end of action
-	trimRightDelim string    // end of action with trim marker
-	pos            Pos       // current position in the input
-	start          Pos       // start position of this item
-	width          Pos       // width of last rune read from input
-	items          chan item // channel of scanned items
-	parenDepth     int       // nesting depth of ( ) exprs
-	line           int       // 1+number of newlines seen
-	startLine      int       // start line of this item
+	name           string          // the name of the input; used only for error reports
+	input          string          // the string being scanned
+	leftDelim      string          // start of action
+	rightDelim     string          // end of action
+	trimRightDelim string          // end of action with trim marker
+	pos            Pos             // current position in the input
+	start          Pos             // start position of this item
+	width          Pos             // width of last rune read from input
+	items          chan item       // channel of scanned items
+	parenDepth     int             // nesting depth of ( ) exprs
+	line           int             // 1+number of newlines seen
+	startLine      int             // start line of this item
+	identifiers    map[string]bool // optional keywords lexed as identifiers
+	last           itemType        // type of the last item emitted, spaces excluded
+	head           bool            // whether the last number emitted starts a command
 }
 
 // next returns the next rune in the input.
@@ -157,6 +185,13 @@ func (l *lexer) emit(t itemType) {
 	l.items <- item{t, l.start, l.input[l.start:l.pos], l.startLine}
 	l.start = l.pos
 	l.startLine = l.line
+	switch t {
+	case itemSpace:
+		return
+	case itemNumber, itemComplex, itemCharConstant:
+		l.head = startsCommand(l.last)
+	}
+	l.last = t
 }
 
 // ignore skips over the pending input before this point.
@@ -202,15 +237,22 @@ func (l *lexer) drain() {
 	}
 }
 
-// lex creates a new scanner for the input string.
+// lex creates a new scanner for the input string and starts it.
 func lex(name, input, left, right string) *lexer {
+	l := newLexer(name, input, left, right)
+	go l.run()
+	return l
+}
+
+// newLexer creates a new scanner for the input string, run must be called to start it.
+func newLexer(name, input, left, right string) *lexer {
 	if left == "" {
 		left = leftDelim
 	}
 	if right == "" {
 		right = rightDelim
 	}
-	l := &lexer{
+	return &lexer{
 		name:           name,
 		input:          input,
 		leftDelim:      left,
@@ -220,8 +262,6 @@ func lex(name, input, left, right string) *lexer {
 		line:           1,
 		startLine:      1,
 	}
-	go l.run()
-	return l
 }
 
 // run runs the state machine for the lexer.
@@ -369,6 +409,10 @@ func lexInsideAction(l *lexer) stateFn {
 		l.backup() // Put space back in case we have " -}}".
 		return lexSpace
 	case r == '=':
+		if l.accept("=") {
+			l.emit(itemOperator)
+			break
+		}
 		l.emit(itemAssign)
 	case r == ':':
 		if l.next() != '=' {
@@ -376,7 +420,21 @@ func lexInsideAction(l *lexer) stateFn {
 		}
 		l.emit(itemDeclare)
 	case r == '|':
+		if l.accept("|") {
+			l.emit(itemOperator)
+			break
+		}
 		l.emit(itemPipe)
+	case r == '&':
+		if !l.accept("&") {
+			return l.errorf("expected &&")
+		}
+		l.emit(itemOperator)
+	case r == '!' || r == '<' || r == '>':
+		l.accept("=")
+		l.emit(itemOperator)
+	case r == '*' || r == '/' || r == '%':
+		l.emit(itemOperator)
 	case r == '"':
 		return lexQuote
 	case r == '`':
@@ -385,6 +443,10 @@ func lexInsideAction(l *lexer) stateFn {
 		return lexVariable
 	case r == '\'':
 		return lexChar
+	case (r == '+' || r == '-') && (l.afterOperand() || l.afterNumber() || !l.atNumber()):
+		// A sign adjacent to the preceding operand, following a number or not
+		// followed by a number is an operator.
+		l.emit(itemOperator)
 	case r == '.':
 		// special look-ahead for ".field" so we don't break l.backup().
 		if l.pos < Pos(len(l.input)) {
@@ -417,6 +479,50 @@ func lexInsideAction(l *lexer) stateFn {
 	return lexInsideAction
 }
 
+// afterOperand reports whether the item being scanned immediately follows an
+// operand, such as the field in ".X-1".
+func (l *lexer) afterOperand() bool {
+	before := l.input[:l.start]
+	if before == "" || strings.HasSuffix(before, l.leftDelim) {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(before)
+	return isAlphaNumeric(r) || strings.ContainsRune(")\"`'", r)
+}
+
+// afterNumber reports whether the last item is a number starting a command,
+// which takes no arguments, such as the 3 in "3 -1". The numbers that are
+// arguments of a command can be followed by negative numbers, as in "slice .X 1 -1".
+func (l *lexer) afterNumber() bool {
+	switch l.last {
+	case itemNumber, itemComplex, itemCharConstant:
+		return l.head
+	}
+	return false
+}
+
+// startsCommand reports whether an item following an item of the given type
+// starts a command.
+func startsCommand(t itemType) bool {
+	switch t {
+	case itemLeftDelim, itemLeftParen, itemPipe, itemOperator, itemDeclare, itemAssign:
+		return true
+	case itemDot, itemNil:
+		return false
+	}
+	return t > itemKeyword
+}
+
+// atNumber reports whether the input at the current position starts with a
+// digit, or a decimal point followed by a digit.
+func (l *lexer) atNumber() bool {
+	input := l.input[l.pos:]
+	if strings.HasPrefix(input, ".") {
+		input = input[1:]
+	}
+	return input != "" && '0' <= input[0] && input[0] <= '9'
+}
+
 // lexSpace scans a run of space characters.
 // We have not consumed the first space, which is known to be present.
 // Take care if there is a trim-marked right delimiter, which starts with a space.
@@ -457,7 +563,7 @@ Loop:
 				return l.errorf("bad character %#U", r)
 			}
 			switch {
-			case key[word] > itemKeyword:
+			case key[word] > itemKeyword && !l.identifiers[word]:
 				l.emit(key[word])
 			case word[0] == '.':
 				l.emit(itemField)
@@ -524,7 +630,7 @@ func (l *lexer) atTerminator() bool {
 		return true
 	}
 	switch r {
-	case eof, '.', ',', '|', ':', ')', '(':
+	case eof, '.', ',', '|', ':', ')', '(', '=', '+', '-', '*', '/', '%', '!', '<', '>', '&':
 		return true
 	}
 	// Does r start the delimiter? This can be ambiguous (with delim=="//", $x/2 will
@@ -566,14 +672,15 @@ func lexNumber(l *lexer) stateFn {
 		return l.errorf("bad number syntax: %q", l.input[l.start:l.pos])
 	}
 	if sign := l.peek(); sign == '+' || sign == '-' {
-		// Complex: 1+2i. No spaces, must end in 'i'.
-		if !l.scanNumber() || l.input[l.pos-1] != 'i' {
-			return l.errorf("bad number syntax: %q", l.input[l.start:l.pos])
+		// Complex: 1+2i. No spaces, must end in 'i'. Otherwise, the sign is an operator.
+		end := l.pos
+		if l.scanNumber() && l.input[l.pos-1] == 'i' {
+			l.emit(itemComplex)
+			return lexInsideAction
 		}
-		l.emit(itemComplex)
-	} else {
-		l.emit(itemNumber)
+		l.pos = end
 	}
+	l.emit(itemNumber)
 	return lexInsideAction
 }
 
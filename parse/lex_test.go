@@ -23,6 +23,7 @@ var itemName = map[itemType]string{
 	itemLeftDelim:    "left delim",
 	itemLeftParen:    "(",
 	itemNumber:       "number",
+	itemOperator:     "operator",
 	itemPipe:         "pipe",
 	itemRawString:    "raw string",
 	itemRightDelim:   "right delim",
@@ -34,13 +35,23 @@ var itemName = map[itemType]string{
 	// keywords
 	itemDot:      ".",
 	itemBlock:    "block",
+	itemBreak:    "break",
+	itemCapture:  "capture",
+	itemCase:     "case",
+	itemCatch:    "catch",
+	itemContinue: "continue",
+	itemDefault:  "default",
 	itemDefine:   "define",
 	itemElse:     "else",
+	itemExtends:  "extends",
 	itemIf:       "if",
 	itemEnd:      "end",
 	itemNil:      "nil",
 	itemRange:    "range",
+	itemSuper:    "super",
+	itemSwitch:   "switch",
 	itemTemplate: "template",
+	itemTry:      "try",
 	itemWith:     "with",
 }
 
@@ -97,7 +108,7 @@ var lexTests = []lexTest{
 		tLeft,
 		mkItem(itemChar, ","),
 		mkItem(itemChar, "@"),
-		mkItem(itemChar, "%"),
+		mkItem(itemOperator, "%"),
 		tSpace,
 		tRight,
 		tEOF,
@@ -202,7 +213,7 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
-	{"keywords", "{{range if else end with}}", []item{
+	{"keywords", "{{range if else end with break capture continue extends super switch case default try catch}}", []item{
 		tLeft,
 		mkItem(itemRange, "range"),
 		tSpace,
@@ -213,9 +224,98 @@ var lexTests = []lexTest{
 		mkItem(itemEnd, "end"),
 		tSpace,
 		mkItem(itemWith, "with"),
+		tSpace,
+		mkItem(itemBreak, "break"),
+		tSpace,
+		mkItem(itemCapture, "capture"),
+		tSpace,
+		mkItem(itemContinue, "continue"),
+		tSpace,
+		mkItem(itemExtends, "extends"),
+		tSpace,
+		mkItem(itemSuper, "super"),
+		tSpace,
+		mkItem(itemSwitch, "switch"),
+		tSpace,
+		mkItem(itemCase, "case"),
+		tSpace,
+		mkItem(itemDefault, "default"),
+		tSpace,
+		mkItem(itemTry, "try"),
+		tSpace,
+		mkItem(itemCatch, "catch"),
 		tRight,
 		tEOF,
 	}},
+	{"operators", "{{+ - * / % == != < <= > >= && || ! -1 -.5 -.X}}", []item{
+		tLeft,
+		mkItem(itemOperator, "+"),
+		tSpace,
+		mkItem(itemOperator, "-"),
+		tSpace,
+		mkItem(itemOperator, "*"),
+		tSpace,
+		mkItem(itemOperator, "/"),
+		tSpace,
+		mkItem(itemOperator, "%"),
+		tSpace,
+		mkItem(itemOperator, "=="),
+		tSpace,
+		mkItem(itemOperator, "!="),
+		tSpace,
+		mkItem(itemOperator, "<"),
+		tSpace,
+		mkItem(itemOperator, "<="),
+		tSpace,
+		mkItem(itemOperator, ">"),
+		tSpace,
+		mkItem(itemOperator, ">="),
+		tSpace,
+		mkItem(itemOperator, "&&"),
+		tSpace,
+		mkItem(itemOperator, "||"),
+		tSpace,
+		mkItem(itemOperator, "!"),
+		tSpace,
+		mkItem(itemNumber, "-1"),
+		tSpace,
+		mkItem(itemOperator, "-"),
+		mkItem(itemNumber, ".5"),
+		tSpace,
+		mkItem(itemOperator, "-"),
+		mkItem(itemField, ".X"),
+		tRight,
+		tEOF,
+	}},
+	{"signs after numbers", "{{1+1 (3 -1) (print 1 -1)}}", []item{
+		tLeft,
+		mkItem(itemNumber, "1"),
+		mkItem(itemOperator, "+"),
+		mkItem(itemNumber, "1"),
+		tSpace,
+		tLpar,
+		mkItem(itemNumber, "3"),
+		tSpace,
+		mkItem(itemOperator, "-"),
+		mkItem(itemNumber, "1"),
+		tRpar,
+		tSpace,
+		tLpar,
+		mkItem(itemIdentifier, "print"),
+		tSpace,
+		mkItem(itemNumber, "1"),
+		tSpace,
+		mkItem(itemNumber, "-1"),
+		tRpar,
+		tRight,
+		tEOF,
+	}},
+	{"single ampersand", "{{.X & .Y}}", []item{
+		tLeft,
+		mkItem(itemField, ".X"),
+		tSpace,
+		mkItem(itemError, "expected &&"),
+	}},
 	{"variables", "{{$c := printf $ $hello $23 $ $var.Field .Method}}", []item{
 		tLeft,
 		mkItem(itemVariable, "$c"),
@@ -363,10 +463,8 @@ var lexTests = []lexTest{
 	// we made lexInsideAction not loop.
 	{"long pipeline deadlock", "{{|||||}}", []item{
 		tLeft,
-		tPipe,
-		tPipe,
-		tPipe,
-		tPipe,
+		mkItem(itemOperator, "||"),
+		mkItem(itemOperator, "||"),
 		tPipe,
 		tRight,
 		tEOF,
@@ -436,7 +534,7 @@ var lexDelimTests = []lexTest{
 		tLeftDelim,
 		mkItem(itemChar, ","),
 		mkItem(itemChar, "@"),
-		mkItem(itemChar, "%"),
+		mkItem(itemOperator, "%"),
 		mkItem(itemChar, "{"),
 		mkItem(itemChar, "{"),
 		mkItem(itemChar, "}"),
@@ -470,7 +568,7 @@ var lexPosTests = []lexTest{
 		{itemLeftDelim, 0, "{{", 1},
 		{itemChar, 2, ",", 1},
 		{itemChar, 3, "@", 1},
-		{itemChar, 4, "%", 1},
+		{itemOperator, 4, "%", 1},
 		{itemChar, 5, "#", 1},
 		{itemRightDelim, 6, "}}", 1},
 		{itemEOF, 8, "", 1},
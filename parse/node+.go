@@ -7,10 +7,15 @@ package parse
 type pos = Pos
 type actionNode = *ActionNode
 type boolNode = *BoolNode
+type breakNode = *BreakNode
 type branchNode = *BranchNode
+type captureNode = *CaptureNode
+type caseNode = *CaseNode
 type chainNode = *ChainNode
 type commandNode = *CommandNode
+type continueNode = *ContinueNode
 type dotNode = *DotNode
+type exprNode = *ExprNode
 type fieldNode = *FieldNode
 type identifierNode = *IdentifierNode
 type ifNode = *IfNode
@@ -20,7 +25,10 @@ type numberNode = *NumberNode
 type pipeNode = *PipeNode
 type rangeNode = *RangeNode
 type stringNode = *StringNode
+type superNode = *SuperNode
+type switchNode = *SwitchNode
 type templateNode = *TemplateNode
 type textNode = *TextNode
+type tryNode = *TryNode
 type variableNode = *VariableNode
 type withNode = *WithNode
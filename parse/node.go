@@ -71,6 +71,16 @@ const (
 	NodeTemplate                   // A template invocation action.
 	NodeVariable                   // A $ variable.
 	NodeWith                       // A with action.
+	NodeBreak                      // A break action.
+	NodeContinue                   // A continue action.
+	NodeSuper                      // A super action.
+	NodeCapture                    // A capture action.
+	NodeSwitch                     // A switch action.
+	NodeCase                       // A case clause of a switch action.
+	nodeDefault                    // A default action. Not added to tree.
+	NodeTry                        // A try action.
+	nodeCatch                      // A catch action. Not added to tree.
+	NodeExpr                       // An operator applied to its operands.
 )
 
 // Nodes.
@@ -304,6 +314,53 @@ func (c commandNode) Copy() Node {
 	return n
 }
 
+// ExprNode holds an arithmetic, comparison or logical operator applied to its
+// operands. Each operand is either a command, for a function applied to its
+// arguments or a single operand, or another expression.
+type ExprNode struct {
+	NodeType
+	Pos
+	tr       *Tree
+	Operator string // The operator, such as "+" or "&&".
+	Operands []Node // The operands in lexical order; a single one for the unary operators.
+}
+
+func (t *Tree) newExpr(pos Pos, operator string, operands ...Node) *ExprNode {
+	return &ExprNode{tr: t, NodeType: NodeExpr, Pos: pos, Operator: operator, Operands: operands}
+}
+
+func (e *ExprNode) String() string {
+	var sb strings.Builder
+	e.writeTo(&sb)
+	return sb.String()
+}
+
+func (e *ExprNode) writeTo(sb *strings.Builder) {
+	if len(e.Operands) == 1 {
+		sb.WriteString(e.Operator)
+		e.Operands[0].writeTo(sb)
+		return
+	}
+	e.Operands[0].writeTo(sb)
+	sb.WriteString(" " + e.Operator + " ")
+	e.Operands[1].writeTo(sb)
+}
+
+func (e *ExprNode) tree() *Tree {
+	return e.tr
+}
+
+func (e exprNode) Copy() Node {
+	if e == nil {
+		return e
+	}
+	operands := make([]Node, len(e.Operands))
+	for i, operand := range e.Operands {
+		operands[i] = operand.Copy()
+	}
+	return e.tr.newExpr(e.Pos, e.Operator, operands...)
+}
+
 // IdentifierNode holds an identifier.
 type IdentifierNode struct {
 	NodeType
@@ -877,14 +934,17 @@ func (i ifNode) Copy() Node {
 // RangeNode represents a {{range}} action and its commands.
 type RangeNode struct {
 	BranchNode
+	Loop bool // Whether the range declares $loop, false if the template declares a $loop in scope.
 }
 
 func (t *Tree) newRange(pos Pos, line int, pipe *PipeNode, list, elseList *ListNode) *RangeNode {
-	return &RangeNode{BranchNode{tr: t, NodeType: NodeRange, Pos: pos, Line: line, Pipe: pipe, List: list, ElseList: elseList}}
+	return &RangeNode{BranchNode{tr: t, NodeType: NodeRange, Pos: pos, Line: line, Pipe: pipe, List: list, ElseList: elseList}, true}
 }
 
 func (r rangeNode) Copy() Node {
-	return r.tr.newRange(r.Pos, r.Line, r.Pipe.CopyPipe(), r.List.CopyList(), r.ElseList.CopyList())
+	n := r.tr.newRange(r.Pos, r.Line, r.Pipe.CopyPipe(), r.List.CopyList(), r.ElseList.CopyList())
+	n.Loop = r.Loop
+	return n
 }
 
 // WithNode represents a {{with}} action and its commands.
@@ -900,14 +960,362 @@ func (w withNode) Copy() Node {
 	return w.tr.newWith(w.Pos, w.Line, w.Pipe.CopyPipe(), w.List.CopyList(), w.ElseList.CopyList())
 }
 
+// BreakNode represents a {{break}} action.
+type BreakNode struct {
+	NodeType
+	Pos
+	tr     *Tree
+	Line   int // The line number in the input.
+	Levels int // The number of enclosing ranges to exit.
+}
+
+func (t *Tree) newBreak(pos Pos, line int, levels int) *BreakNode {
+	return &BreakNode{tr: t, NodeType: NodeBreak, Pos: pos, Line: line, Levels: levels}
+}
+
+func (b *BreakNode) String() string {
+	var sb strings.Builder
+	b.writeTo(&sb)
+	return sb.String()
+}
+
+func (b *BreakNode) writeTo(sb *strings.Builder) { writeLoopControl(sb, "break", b.Levels) }
+
+func (b *BreakNode) tree() *Tree {
+	return b.tr
+}
+
+func (b breakNode) Copy() Node {
+	return b.tr.newBreak(b.Pos, b.Line, b.Levels)
+}
+
+// ContinueNode represents a {{continue}} action.
+type ContinueNode struct {
+	NodeType
+	Pos
+	tr     *Tree
+	Line   int // The line number in the input.
+	Levels int // The number of enclosing ranges to exit, the outermost one continues.
+}
+
+func (t *Tree) newContinue(pos Pos, line int, levels int) *ContinueNode {
+	return &ContinueNode{tr: t, NodeType: NodeContinue, Pos: pos, Line: line, Levels: levels}
+}
+
+func (c *ContinueNode) String() string {
+	var sb strings.Builder
+	c.writeTo(&sb)
+	return sb.String()
+}
+
+func (c *ContinueNode) writeTo(sb *strings.Builder) { writeLoopControl(sb, "continue", c.Levels) }
+
+func (c *ContinueNode) tree() *Tree {
+	return c.tr
+}
+
+func (c continueNode) Copy() Node {
+	return c.tr.newContinue(c.Pos, c.Line, c.Levels)
+}
+
+// CaptureNode represents a {{capture}} action and the list whose output it captures.
+type CaptureNode struct {
+	NodeType
+	Pos
+	tr       *Tree
+	Line     int           // The line number in the input.
+	Variable *VariableNode // The variable declared with the captured output.
+	List     *ListNode     // What to execute.
+}
+
+func (t *Tree) newCapture(pos Pos, line int, variable *VariableNode, list *ListNode) *CaptureNode {
+	return &CaptureNode{tr: t, NodeType: NodeCapture, Pos: pos, Line: line, Variable: variable, List: list}
+}
+
+func (c *CaptureNode) String() string {
+	var sb strings.Builder
+	c.writeTo(&sb)
+	return sb.String()
+}
+
+func (c *CaptureNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{capture ")
+	c.Variable.writeTo(sb)
+	sb.WriteString("}}")
+	c.List.writeTo(sb)
+	sb.WriteString("{{end}}")
+}
+
+func (c *CaptureNode) tree() *Tree {
+	return c.tr
+}
+
+func (c captureNode) Copy() Node {
+	return c.tr.newCapture(c.Pos, c.Line, c.Variable.Copy().(*VariableNode), c.List.CopyList())
+}
+
+// defaultNode represents a {{default}} action. Does not appear in the final tree.
+type defaultNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Line int // The line number in the input.
+}
+
+func (t *Tree) newDefault(pos Pos, line int) *defaultNode {
+	return &defaultNode{tr: t, NodeType: nodeDefault, Pos: pos, Line: line}
+}
+
+func (d *defaultNode) String() string {
+	return "{{default}}"
+}
+
+func (d *defaultNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(d.String())
+}
+
+func (d *defaultNode) tree() *Tree {
+	return d.tr
+}
+
+func (d *defaultNode) Copy() Node {
+	return d.tr.newDefault(d.Pos, d.Line)
+}
+
+// SwitchNode represents a {{switch}} action and its cases.
+type SwitchNode struct {
+	NodeType
+	Pos
+	tr      *Tree
+	Line    int         // The line number in the input.
+	Pipe    *PipeNode   // The pipeline to be compared to the values of the cases.
+	Cases   []*CaseNode // The cases, in order of evaluation.
+	Default *ListNode   // What to execute if no case matches (or nil).
+}
+
+func (t *Tree) newSwitch(pos Pos, line int, pipe *PipeNode) *SwitchNode {
+	return &SwitchNode{tr: t, NodeType: NodeSwitch, Pos: pos, Line: line, Pipe: pipe}
+}
+
+func (s *SwitchNode) String() string {
+	var sb strings.Builder
+	s.writeTo(&sb)
+	return sb.String()
+}
+
+func (s *SwitchNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{switch ")
+	s.Pipe.writeTo(sb)
+	sb.WriteString("}}")
+	for _, c := range s.Cases {
+		c.writeTo(sb)
+	}
+	if s.Default != nil {
+		sb.WriteString("{{default}}")
+		s.Default.writeTo(sb)
+	}
+	sb.WriteString("{{end}}")
+}
+
+func (s *SwitchNode) tree() *Tree {
+	return s.tr
+}
+
+func (s switchNode) Copy() Node {
+	n := s.tr.newSwitch(s.Pos, s.Line, s.Pipe.CopyPipe())
+	for _, c := range s.Cases {
+		n.Cases = append(n.Cases, c.Copy().(*CaseNode))
+	}
+	n.Default = s.Default.CopyList()
+	return n
+}
+
+// CaseNode represents a {{case}} clause of a switch and its commands.
+type CaseNode struct {
+	NodeType
+	Pos
+	tr     *Tree
+	Line   int       // The line number in the input.
+	Values []Node    // The values compared to the pipeline of the switch.
+	List   *ListNode // What to execute if one of the values matches.
+}
+
+func (t *Tree) newCase(pos Pos, line int, values []Node) *CaseNode {
+	return &CaseNode{tr: t, NodeType: NodeCase, Pos: pos, Line: line, Values: values}
+}
+
+func (c *CaseNode) String() string {
+	var sb strings.Builder
+	c.writeTo(&sb)
+	return sb.String()
+}
+
+func (c *CaseNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{case")
+	for _, value := range c.Values {
+		sb.WriteByte(' ')
+		if pipe, ok := value.(*PipeNode); ok {
+			sb.WriteByte('(')
+			pipe.writeTo(sb)
+			sb.WriteByte(')')
+			continue
+		}
+		value.writeTo(sb)
+	}
+	sb.WriteString("}}")
+	if c.List != nil {
+		c.List.writeTo(sb)
+	}
+}
+
+func (c *CaseNode) tree() *Tree {
+	return c.tr
+}
+
+func (c caseNode) Copy() Node {
+	values := make([]Node, len(c.Values))
+	for i, value := range c.Values {
+		values[i] = value.Copy()
+	}
+	n := c.tr.newCase(c.Pos, c.Line, values)
+	n.List = c.List.CopyList()
+	return n
+}
+
+// TryNode represents a {{try}} action and its commands.
+type TryNode struct {
+	NodeType
+	Pos
+	tr       *Tree
+	Line     int           // The line number in the input.
+	List     *ListNode     // What to execute.
+	Variable *VariableNode // The variable declared with the error in the catch list (or nil).
+	Catch    *ListNode     // What to execute if the list fails (or nil).
+}
+
+func (t *Tree) newTry(pos Pos, line int) *TryNode {
+	return &TryNode{tr: t, NodeType: NodeTry, Pos: pos, Line: line}
+}
+
+func (t *TryNode) String() string {
+	var sb strings.Builder
+	t.writeTo(&sb)
+	return sb.String()
+}
+
+func (t *TryNode) writeTo(sb *strings.Builder) {
+	sb.WriteString("{{try}}")
+	t.List.writeTo(sb)
+	if t.Catch != nil {
+		sb.WriteString("{{catch")
+		if t.Variable != nil {
+			sb.WriteByte(' ')
+			t.Variable.writeTo(sb)
+		}
+		sb.WriteString("}}")
+		t.Catch.writeTo(sb)
+	}
+	sb.WriteString("{{end}}")
+}
+
+func (t *TryNode) tree() *Tree {
+	return t.tr
+}
+
+func (t tryNode) Copy() Node {
+	n := t.tr.newTry(t.Pos, t.Line)
+	n.List = t.List.CopyList()
+	if t.Variable != nil {
+		n.Variable = t.Variable.Copy().(*VariableNode)
+	}
+	n.Catch = t.Catch.CopyList()
+	return n
+}
+
+// catchNode represents a {{catch}} action. Does not appear in the final tree.
+type catchNode struct {
+	NodeType
+	Pos
+	tr       *Tree
+	Line     int           // The line number in the input.
+	Variable *VariableNode // The variable declared with the error (or nil).
+}
+
+func (t *Tree) newCatch(pos Pos, line int, variable *VariableNode) *catchNode {
+	return &catchNode{tr: t, NodeType: nodeCatch, Pos: pos, Line: line, Variable: variable}
+}
+
+func (c *catchNode) String() string {
+	if c.Variable == nil {
+		return "{{catch}}"
+	}
+	return "{{catch " + c.Variable.String() + "}}"
+}
+
+func (c *catchNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(c.String())
+}
+
+func (c *catchNode) tree() *Tree {
+	return c.tr
+}
+
+func (c *catchNode) Copy() Node {
+	if c.Variable == nil {
+		return c.tr.newCatch(c.Pos, c.Line, nil)
+	}
+	return c.tr.newCatch(c.Pos, c.Line, c.Variable.Copy().(*VariableNode))
+}
+
+// SuperNode represents a {{super}} action.
+type SuperNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Line int // The line number in the input.
+}
+
+func (t *Tree) newSuper(pos Pos, line int) *SuperNode {
+	return &SuperNode{tr: t, NodeType: NodeSuper, Pos: pos, Line: line}
+}
+
+func (s *SuperNode) String() string {
+	return "{{super}}"
+}
+
+func (s *SuperNode) writeTo(sb *strings.Builder) {
+	sb.WriteString(s.String())
+}
+
+func (s *SuperNode) tree() *Tree {
+	return s.tr
+}
+
+func (s superNode) Copy() Node {
+	return s.tr.newSuper(s.Pos, s.Line)
+}
+
+func writeLoopControl(sb *strings.Builder, keyword string, levels int) {
+	sb.WriteString("{{")
+	sb.WriteString(keyword)
+	if levels > 1 {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.Itoa(levels))
+	}
+	sb.WriteString("}}")
+}
+
 // TemplateNode represents a {{template}} action.
 type TemplateNode struct {
 	NodeType
 	Pos
-	tr   *Tree
-	Line int       // The line number in the input. Deprecated: Kept for compatibility.
-	Name string    // The name of the template (unquoted).
-	Pipe *PipeNode // The command to evaluate as dot for the template.
+	tr       *Tree
+	Line     int         // The line number in the input. Deprecated: Kept for compatibility.
+	Name     string      // The name of the template (unquoted), empty if the name is dynamic.
+	NameExpr Node        // The operand evaluated at execution time to get the name, nil if the name is constant.
+	Pipe     *PipeNode   // The command to evaluate as dot for the template.
+	Args     []*NamedArg // The named arguments supplied to the template.
+	Block    bool        // The invocation is made by a {{block}}, it can be overridden.
 }
 
 func (t *Tree) newTemplate(pos Pos, line int, name string, pipe *PipeNode) *TemplateNode {
@@ -922,11 +1330,24 @@ func (t *TemplateNode) String() string {
 
 func (t *TemplateNode) writeTo(sb *strings.Builder) {
 	sb.WriteString("{{template ")
-	sb.WriteString(strconv.Quote(t.Name))
+	switch name := t.NameExpr.(type) {
+	case nil:
+		sb.WriteString(strconv.Quote(t.Name))
+	case *PipeNode:
+		sb.WriteByte('(')
+		name.writeTo(sb)
+		sb.WriteByte(')')
+	default:
+		name.writeTo(sb)
+	}
 	if t.Pipe != nil {
 		sb.WriteByte(' ')
 		t.Pipe.writeTo(sb)
 	}
+	for _, arg := range t.Args {
+		sb.WriteByte(' ')
+		arg.writeTo(sb)
+	}
 	sb.WriteString("}}")
 }
 
@@ -935,5 +1356,54 @@ func (t *TemplateNode) tree() *Tree {
 }
 
 func (t templateNode) Copy() Node {
-	return t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	node := t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	if t.NameExpr != nil {
+		node.NameExpr = t.NameExpr.Copy()
+	}
+	node.Args = copyNamedArgs(t.Args)
+	node.Block = t.Block
+	return node
+}
+
+// NamedArg is a named argument supplied to a {{template}} or {{block}} invocation,
+// or a parameter declared by {{define}} with its optional default value.
+type NamedArg struct {
+	Pos
+	Name  string // The name of the argument, also the name of the variable in the callee (without $).
+	Value Node   // The value of the argument, nil for a parameter without default value.
+}
+
+func (a *NamedArg) String() string {
+	var sb strings.Builder
+	a.writeTo(&sb)
+	return sb.String()
+}
+
+func (a *NamedArg) writeTo(sb *strings.Builder) {
+	sb.WriteString(a.Name)
+	if a.Value == nil {
+		return
+	}
+	sb.WriteByte('=')
+	if pipe, ok := a.Value.(*PipeNode); ok {
+		sb.WriteByte('(')
+		pipe.writeTo(sb)
+		sb.WriteByte(')')
+		return
+	}
+	a.Value.writeTo(sb)
+}
+
+func copyNamedArgs(args []*NamedArg) []*NamedArg {
+	if args == nil {
+		return nil
+	}
+	result := make([]*NamedArg, len(args))
+	for i, arg := range args {
+		result[i] = &NamedArg{Pos: arg.Pos, Name: arg.Name}
+		if arg.Value != nil {
+			result[i].Value = arg.Value.Copy()
+		}
+	}
+	return result
 }
@@ -18,17 +18,26 @@ import (
 
 // Tree is the representation of a single parsed template.
 type Tree struct {
-	Name      string    // name of the template represented by the tree.
-	ParseName string    // name of the top-level template during parsing, for error messages.
-	Root      *ListNode // top-level root of the tree.
-	text      string    // text parsed to create the template (or its parent)
+	Name      string           // name of the template represented by the tree.
+	ParseName string           // name of the top-level template during parsing, for error messages.
+	Root      *ListNode        // top-level root of the tree.
+	Params    []*NamedArg      // parameters declared by {{define}} or {{block}}.
+	Extends   string           // name of the template extended by this one, if any.
+	Blocks    map[string]*Tree // blocks overridden by this template if it extends another one.
+	text      string           // text parsed to create the template (or its parent)
+	right     string           // right delimiter of the actions in text.
 	// Parsing only; cleared after parse.
-	funcs     []map[string]interface{}
-	lex       *lexer
-	token     [3]item // three-token lookahead for parser.
-	peekCount int
-	vars      []string // variables defined at the moment.
-	treeSet   map[string]*Tree
+	funcs      []map[string]interface{}
+	lex        *lexer
+	token      [3]item // three-token lookahead for parser.
+	peekCount  int
+	vars       []string // variables defined at the moment.
+	treeSet    map[string]*Tree
+	rangeDepth int              // nesting level of range loops.
+	namedArgs  bool             // named arguments terminate the pipeline being parsed.
+	overrides  map[string]*Tree // blocks of the extending template being parsed.
+	overriding bool             // the tree is a block of an extending template.
+	loops      []int            // positions in vars of the $loop declared by the enclosing ranges.
 }
 
 // Copy returns a copy of the Tree. Any parsing state is discarded.
@@ -40,10 +49,25 @@ func (t *Tree) Copy() *Tree {
 		Name:      t.Name,
 		ParseName: t.ParseName,
 		Root:      t.Root.CopyList(),
+		Params:    copyNamedArgs(t.Params),
+		Extends:   t.Extends,
+		Blocks:    copyTrees(t.Blocks),
 		text:      t.text,
+		right:     t.right,
 	}
 }
 
+func copyTrees(trees map[string]*Tree) map[string]*Tree {
+	if trees == nil {
+		return nil
+	}
+	result := make(map[string]*Tree, len(trees))
+	for name, tree := range trees {
+		result[name] = tree.Copy()
+	}
+	return result
+}
+
 // Parse returns a map from template name to parse.Tree, created by parsing the
 // templates described in the argument string. The top-level template will be
 // given the specified name. If an error is encountered, parsing stops and an
@@ -146,6 +170,54 @@ func (t *Tree) ErrorContext(n Node) (location, context string) {
 	return fmt.Sprintf("%s:%d:%d", tree.ParseName, lineNum, byteNum), context
 }
 
+// Source returns the text of the node in the input text, from its position to its end.
+// A text node ends with its text, any other node ends with the action in which it starts,
+// right delimiter and trim marker excluded. So, the source of a control structure such as
+// {{if}} is its pipeline and the source of an empty list is the action that ends it.
+// As for ErrorContext, the receiver is only used when the node does not have a pointer
+// to the tree inside.
+func (t *Tree) Source(n Node) string {
+	pos := int(n.Position())
+	tree := n.tree()
+	if tree == nil {
+		tree = t
+	}
+	text := tree.text[pos:]
+	if n, ok := n.(*TextNode); ok {
+		return text[:len(n.Text)]
+	}
+	right := tree.right
+	if right == "" {
+		right = rightDelim
+	}
+	text = text[:actionEnd(text, right)]
+	return strings.TrimRight(strings.TrimSuffix(text, rightTrimMarker), " \t\r\n")
+}
+
+// actionEnd returns the position of the right delimiter ending the action in text,
+// skipping the delimiters that are quoted.
+func actionEnd(text, right string) int {
+	for i := 0; i < len(text); i++ {
+		switch quote := text[i]; quote {
+		case '"', '\'':
+			for i++; i < len(text) && text[i] != quote; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case '`':
+			if end := strings.IndexByte(text[i+1:], '`'); end >= 0 {
+				i += end + 1
+			}
+		default:
+			if strings.HasPrefix(text[i:], right) {
+				return i
+			}
+		}
+	}
+	return len(text)
+}
+
 // errorf formats the error and terminates processing.
 func (t *Tree) errorf(format string, args ...interface{}) {
 	t.Root = nil
@@ -211,6 +283,10 @@ func (t *Tree) stopParse() {
 	t.vars = nil
 	t.funcs = nil
 	t.treeSet = nil
+	t.rangeDepth = 0
+	t.overrides = nil
+	t.overriding = false
+	t.loops = nil
 }
 
 // Parse parses the template definition string to construct a representation of
@@ -220,8 +296,16 @@ func (t *Tree) stopParse() {
 func (t *Tree) Parse(text, leftDelim, rightDelim string, treeSet map[string]*Tree, funcs ...map[string]interface{}) (tree *Tree, err error) {
 	defer t.recover(&err)
 	t.ParseName = t.Name
-	t.startParse(funcs, lex(t.Name, text, leftDelim, rightDelim), treeSet)
-	t.text = text
+	t.funcs = funcs
+	// Optional keywords remain identifiers if functions with these names are defined.
+	lexer := newLexer(t.Name, text, leftDelim, rightDelim)
+	lexer.identifiers = make(map[string]bool)
+	for _, keyword := range optionalKeywords {
+		lexer.identifiers[keyword] = t.hasFunction(keyword)
+	}
+	go lexer.run()
+	t.startParse(funcs, lexer, treeSet)
+	t.text, t.right = text, lexer.rightDelim
 	t.parse()
 	t.add()
 	t.stopParse()
@@ -246,6 +330,9 @@ func IsEmptyTree(n Node) bool {
 	case nil:
 		return true
 	case *ActionNode:
+	case *BreakNode:
+	case *CaptureNode:
+	case *ContinueNode:
 	case *IfNode:
 	case *ListNode:
 		for _, node := range n.Nodes {
@@ -255,7 +342,10 @@ func IsEmptyTree(n Node) bool {
 		}
 		return true
 	case *RangeNode:
+	case *SuperNode:
+	case *SwitchNode:
 	case *TemplateNode:
+	case *TryNode:
 	case *TextNode:
 		return len(bytes.TrimSpace(n.Text)) == 0
 	case *WithNode:
@@ -273,28 +363,44 @@ func (t *Tree) parse() {
 	for t.peek().typ != itemEOF {
 		if t.peek().typ == itemLeftDelim {
 			delim := t.next()
-			if t.nextNonSpace().typ == itemDefine {
+			switch t.nextNonSpace().typ {
+			case itemDefine:
 				newT := New("definition") // name will be updated once we know it.
-				newT.text = t.text
+				newT.text, newT.right = t.text, t.right
 				newT.ParseName = t.ParseName
 				newT.startParse(t.funcs, t.lex, t.treeSet)
 				newT.parseDefinition()
 				continue
+			case itemExtends:
+				t.extendsControl()
+				continue
 			}
 			t.backup2(delim)
 		}
 		switch n := t.textOrAction(); n.Type() {
-		case nodeEnd, nodeElse:
+		case nodeEnd, nodeElse, NodeCase, nodeDefault, nodeCatch:
 			t.errorf("unexpected %s", n)
 		default:
+			if t.Extends != "" && !isBlock(n) && !IsEmptyTree(n) {
+				// The content of an extending template is never executed.
+				t.errorf("only spaces and {{block}} are allowed after {{extends}} in template %q", t.Name)
+			}
 			t.Root.append(n)
 		}
 	}
 }
 
+// isBlock reports whether the node is the invocation of a {{block}}.
+func isBlock(n Node) bool {
+	template, ok := n.(*TemplateNode)
+	return ok && template.Block
+}
+
 // parseDefinition parses a {{define}} ...  {{end}} template definition and
 // installs the definition in t.treeSet. The "define" keyword has already
-// been scanned.
+// been scanned. The name can be followed by parameters, with optional
+// default values:
+//	{{define "name" param param=operand}}
 func (t *Tree) parseDefinition() {
 	const context = "define clause"
 	name := t.expectOneOf(itemString, itemRawString, context)
@@ -303,7 +409,7 @@ func (t *Tree) parseDefinition() {
 	if err != nil {
 		t.error(err)
 	}
-	t.expect(itemRightDelim, context)
+	t.declareParams(t.namedArgList(context, true))
 	var end Node
 	t.Root, end = t.itemList()
 	if end.Type() != nodeEnd {
@@ -315,13 +421,13 @@ func (t *Tree) parseDefinition() {
 
 // itemList:
 //	textOrAction*
-// Terminates at {{end}} or {{else}}, returned separately.
+// Terminates at {{end}}, {{else}}, {{case}}, {{default}} or {{catch}}, returned separately.
 func (t *Tree) itemList() (list *ListNode, next Node) {
 	list = t.newList(t.peekNonSpace().pos)
 	for t.peekNonSpace().typ != itemEOF {
 		n := t.textOrAction()
 		switch n.Type() {
-		case nodeEnd, nodeElse:
+		case nodeEnd, nodeElse, NodeCase, nodeDefault, nodeCatch:
 			return list, n
 		}
 		list.append(n)
@@ -353,16 +459,36 @@ func (t *Tree) action() (n Node) {
 	switch token := t.nextNonSpace(); token.typ {
 	case itemBlock:
 		return t.blockControl()
+	case itemBreak:
+		return t.breakControl(token.pos, token.line)
+	case itemCapture:
+		return t.captureControl()
+	case itemCase:
+		return t.caseControl(token.pos, token.line)
+	case itemCatch:
+		return t.catchControl(token.pos, token.line)
+	case itemContinue:
+		return t.continueControl(token.pos, token.line)
+	case itemDefault:
+		return t.defaultControl(token.pos, token.line)
 	case itemElse:
 		return t.elseControl()
 	case itemEnd:
 		return t.endControl()
+	case itemExtends:
+		t.errorf("{{extends}} must be at the top level of the template")
 	case itemIf:
 		return t.ifControl()
 	case itemRange:
 		return t.rangeControl()
+	case itemSuper:
+		return t.superControl(token.pos, token.line)
+	case itemSwitch:
+		return t.switchControl()
 	case itemTemplate:
 		return t.templateControl()
+	case itemTry:
+		return t.tryControl(token.pos, token.line)
 	case itemWith:
 		return t.withControl()
 	}
@@ -414,16 +540,25 @@ decls:
 		}
 	}
 	for {
+		if t.namedArgs && t.namedArgAhead() {
+			// The pipeline is followed by named arguments.
+			t.checkPipeline(pipe, context)
+			return
+		}
 		switch token := t.nextNonSpace(); token.typ {
 		case itemRightDelim, itemRightParen:
 			// At this point, the pipeline is complete
 			t.checkPipeline(pipe, context)
+			if token.typ == itemRightDelim {
+				// No named arguments can follow the end of the action.
+				t.namedArgs = false
+			}
 			if token.typ == itemRightParen {
 				t.backup()
 			}
 			return
 		case itemBool, itemCharConstant, itemComplex, itemDot, itemField, itemIdentifier,
-			itemNumber, itemNil, itemRawString, itemString, itemVariable, itemLeftParen:
+			itemNumber, itemNil, itemRawString, itemString, itemVariable, itemLeftParen, itemOperator:
 			t.backup()
 			pipe.append(t.command())
 		default:
@@ -440,7 +575,7 @@ func (t *Tree) checkPipeline(pipe *PipeNode, context string) {
 	// Only the first command of a pipeline can start with a non executable operand
 	for i, c := range pipe.Cmds[1:] {
 		switch c.Args[0].Type() {
-		case NodeBool, NodeDot, NodeNil, NodeNumber, NodeString:
+		case NodeBool, NodeDot, NodeExpr, NodeNil, NodeNumber, NodeString:
 			// With A|B|C, pipeline stage 2 is B
 			t.errorf("non executable command in pipeline stage %d", i+2)
 		}
@@ -451,7 +586,16 @@ func (t *Tree) parseControl(allowElseIf bool, context string) (pos Pos, line int
 	defer t.popVars(len(t.vars))
 	pipe = t.pipeline(context)
 	var next Node
+	if context == "range" {
+		t.rangeDepth++
+		if !t.loopShadowed() {
+			t.declareLoop()
+		}
+	}
 	list, next = t.itemList()
+	if context == "range" {
+		t.rangeDepth--
+	}
 	switch next.Type() {
 	case nodeEnd: //done
 	case nodeElse:
@@ -476,6 +620,8 @@ func (t *Tree) parseControl(allowElseIf bool, context string) (pos Pos, line int
 		if next.Type() != nodeEnd {
 			t.errorf("expected end; found %s", next)
 		}
+	default:
+		t.errorf("unexpected %s in %s", next, context)
 	}
 	return pipe.Position(), pipe.Line, pipe, list, elseList
 }
@@ -491,9 +637,16 @@ func (t *Tree) ifControl() Node {
 // Range:
 //	{{range pipeline}} itemList {{end}}
 //	{{range pipeline}} itemList {{else}} itemList {{end}}
-// Range keyword is past.
+// Range keyword is past. The range declares $loop unless a $loop declared by
+// the template, possibly by the range itself, is in scope.
 func (t *Tree) rangeControl() Node {
-	return t.newRange(t.parseControl(false, "range"))
+	shadowed := t.loopShadowed()
+	r := t.newRange(t.parseControl(false, "range"))
+	for _, v := range r.Pipe.Decl {
+		shadowed = shadowed || v.Ident[0] == "$loop"
+	}
+	r.Loop = !shadowed
+	return r
 }
 
 // With:
@@ -504,6 +657,220 @@ func (t *Tree) withControl() Node {
 	return t.newWith(t.parseControl(false, "with"))
 }
 
+// Capture:
+//	{{capture $variable}} itemList {{end}}
+// Capture keyword is past. The variable is declared after the {{end}}, with
+// the output of the list.
+func (t *Tree) captureControl() Node {
+	const context = "capture clause"
+	token := t.nextNonSpace()
+	if token.typ != itemVariable {
+		t.unexpected(token, context)
+	}
+	variable := t.newVariable(token.pos, token.val)
+	t.expect(itemRightDelim, context)
+	vars := len(t.vars)
+	list, end := t.itemList()
+	if end.Type() != nodeEnd {
+		t.errorf("unexpected %s in %s", end, context)
+	}
+	t.popVars(vars)
+	t.vars = append(t.vars, variable.Ident[0])
+	return t.newCapture(token.pos, token.line, variable, list)
+}
+
+// Switch:
+//	{{switch pipeline}} ({{case operand+}} itemList)* ({{default}} itemList)? {{end}}
+// Switch keyword is past. Only spaces are allowed before the first case.
+// {{else}} is accepted in place of {{default}}, it is the only way to write the
+// default case if a function named default is defined.
+func (t *Tree) switchControl() Node {
+	const context = "switch"
+	defer t.popVars(len(t.vars))
+	pipe := t.pipeline(context)
+	node := t.newSwitch(pipe.Position(), pipe.Line, pipe)
+	list, next := t.itemList()
+	if !IsEmptyTree(list) {
+		t.errorf("only spaces are allowed before the first {{case}} in %s", context)
+	}
+	for {
+		switch n := next.(type) {
+		case *CaseNode:
+			if node.Default != nil {
+				t.errorf("{{case}} after {{default}} in %s", context)
+			}
+			n.List, next = t.itemList()
+			node.Cases = append(node.Cases, n)
+		case *defaultNode, *elseNode:
+			if node.Default != nil {
+				t.errorf("multiple {{default}} in %s", context)
+			}
+			if t.peekNonSpace().typ == itemIf {
+				t.errorf("{{else if}} in %s", context)
+			}
+			node.Default, next = t.itemList()
+		case *endNode:
+			return node
+		default:
+			t.errorf("unexpected %s in %s", next, context)
+		}
+	}
+}
+
+// Case:
+//	{{case operand+}}
+// Case keyword is past. The list following the case is parsed by switchControl.
+func (t *Tree) caseControl(pos Pos, line int) Node {
+	const context = "case"
+	var values []Node
+	for {
+		token := t.nextNonSpace()
+		if token.typ == itemRightDelim {
+			break
+		}
+		t.backup()
+		value := t.operand()
+		if value == nil {
+			t.unexpected(token, context)
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		t.errorf("missing value for %s", context)
+	}
+	return t.newCase(pos, line, values)
+}
+
+// Default:
+//	{{default}}
+// Default keyword is past.
+func (t *Tree) defaultControl(pos Pos, line int) Node {
+	t.expect(itemRightDelim, "default")
+	return t.newDefault(pos, line)
+}
+
+// Try:
+//	{{try}} itemList {{end}}
+//	{{try}} itemList {{catch}} itemList {{end}}
+//	{{try}} itemList {{catch $variable}} itemList {{end}}
+// Try keyword is past. It is only available with the trap function. The variable
+// is declared in the catch list.
+func (t *Tree) tryControl(pos Pos, line int) Node {
+	const context = "try"
+	if !t.hasFunction("trap") {
+		t.errorf("{{try}} requires the Trap option")
+	}
+	t.expect(itemRightDelim, context)
+	vars := len(t.vars)
+	defer t.popVars(vars)
+	node := t.newTry(pos, line)
+	var next Node
+	node.List, next = t.itemList()
+	if catch, isCatch := next.(*catchNode); isCatch {
+		// The variables declared by the try list are not visible in the catch list.
+		t.popVars(vars)
+		if catch.Variable != nil {
+			t.vars = append(t.vars, catch.Variable.Ident[0])
+		}
+		node.Variable = catch.Variable
+		node.Catch, next = t.itemList()
+	}
+	if next.Type() != nodeEnd {
+		t.errorf("unexpected %s in %s", next, context)
+	}
+	return node
+}
+
+// Catch:
+//	{{catch}}
+//	{{catch $variable}}
+// Catch keyword is past.
+func (t *Tree) catchControl(pos Pos, line int) Node {
+	const context = "catch"
+	var variable *VariableNode
+	token := t.nextNonSpace()
+	if token.typ == itemVariable {
+		variable = t.newVariable(token.pos, token.val)
+		token = t.nextNonSpace()
+	}
+	if token.typ != itemRightDelim {
+		t.unexpected(token, context)
+	}
+	return t.newCatch(pos, line, variable)
+}
+
+// Break:
+//	{{break}}
+//	{{break levels}}
+// Break keyword is past.
+func (t *Tree) breakControl(pos Pos, line int) Node {
+	return t.newBreak(pos, line, t.loopControlLevels("break"))
+}
+
+// Continue:
+//	{{continue}}
+//	{{continue levels}}
+// Continue keyword is past.
+func (t *Tree) continueControl(pos Pos, line int) Node {
+	return t.newContinue(pos, line, t.loopControlLevels("continue"))
+}
+
+// loopControlLevels parses the optional number of enclosing ranges affected by
+// a break or continue and validates it against the current range nesting.
+func (t *Tree) loopControlLevels(keyword string) int {
+	context := "{{" + keyword + "}}"
+	if t.rangeDepth == 0 {
+		t.errorf("%s outside {{range}}", context)
+	}
+	levels := 1
+	token := t.nextNonSpace()
+	if token.typ == itemNumber {
+		var err error
+		if levels, err = strconv.Atoi(token.val); err != nil || levels < 1 {
+			t.errorf("invalid %s levels: %s", context, token.val)
+		}
+		if levels > t.rangeDepth {
+			t.errorf("%s %d exceeds the %d enclosing {{range}}", keyword, levels, t.rangeDepth)
+		}
+		token = t.nextNonSpace()
+	}
+	if token.typ != itemRightDelim {
+		t.unexpected(token, context)
+	}
+	return levels
+}
+
+// Extends:
+//	{{extends stringValue}}
+// Extends keyword is past. It must precede the content of the template, whose
+// blocks then override the ones of the extended template instead of being
+// added to the tree set.
+func (t *Tree) extendsControl() {
+	const context = "extends clause"
+	if t.Extends != "" {
+		t.errorf("multiple {{extends}} in template %q", t.Name)
+	}
+	if !IsEmptyTree(t.Root) {
+		t.errorf("{{extends}} must precede the content of the template")
+	}
+	t.Extends = t.parseTemplateName(t.nextNonSpace(), context)
+	t.expect(itemRightDelim, context)
+	t.overrides = make(map[string]*Tree)
+	t.Blocks = t.overrides
+}
+
+// Super:
+//	{{super}}
+// Super keyword is past. It is only allowed in the blocks of a template
+// extending another one.
+func (t *Tree) superControl(pos Pos, line int) Node {
+	if !t.overriding {
+		t.errorf("{{super}} outside a {{block}} of an extending template")
+	}
+	t.expect(itemRightDelim, "{{super}}")
+	return t.newSuper(pos, line)
+}
+
 // End:
 //	{{end}}
 // End keyword is past.
@@ -527,46 +894,158 @@ func (t *Tree) elseControl() Node {
 
 // Block:
 //	{{block stringValue pipeline}}
+//	{{block stringValue pipeline? (name=operand)*}}
 // Block keyword is past.
 // The name must be something that can evaluate to a string.
-// The pipeline is mandatory.
+// The pipeline is mandatory unless named arguments are supplied.
+// The named arguments are declared as parameters of the block.
 func (t *Tree) blockControl() Node {
 	const context = "block clause"
 
 	token := t.nextNonSpace()
 	name := t.parseTemplateName(token, context)
-	pipe := t.pipeline(context)
+	pipe, args := t.templateArgs(context, true)
 
 	block := New(name) // name will be updated once we know it.
-	block.text = t.text
+	block.text, block.right = t.text, t.right
 	block.ParseName = t.ParseName
 	block.startParse(t.funcs, t.lex, t.treeSet)
+	if t.overrides != nil {
+		// The block overrides the one of the extended template.
+		block.overrides, block.overriding = t.overrides, true
+	}
+	params := make([]*NamedArg, len(args))
+	for i, arg := range args {
+		params[i] = &NamedArg{Pos: arg.Pos, Name: arg.Name}
+	}
+	block.declareParams(params)
 	var end Node
 	block.Root, end = block.itemList()
 	if end.Type() != nodeEnd {
 		t.errorf("unexpected %s in %s", end, context)
 	}
-	block.add()
+	if block.overriding {
+		if t.overrides[name] != nil {
+			t.errorf("multiple definition of block %q", name)
+		}
+		t.overrides[name] = block
+	} else {
+		block.add()
+	}
 	block.stopParse()
 
-	return t.newTemplate(token.pos, token.line, name, pipe)
+	node := t.newTemplate(token.pos, token.line, name, pipe)
+	node.Args = args
+	node.Block = true
+	return node
 }
 
 // Template:
 //	{{template stringValue pipeline}}
+//	{{template operand pipeline}}
+//	{{template stringValue pipeline? (name=operand)*}}
 // Template keyword is past. The name must be something that can evaluate
-// to a string.
+// to a string. If it is not a constant, it is evaluated at execution time.
+// The named arguments are supplied to the parameters of the template.
 func (t *Tree) templateControl() Node {
 	const context = "template clause"
 	token := t.nextNonSpace()
-	name := t.parseTemplateName(token, context)
-	var pipe *PipeNode
-	if t.nextNonSpace().typ != itemRightDelim {
-		t.backup()
+	var name string
+	var nameExpr Node
+	switch token.typ {
+	case itemString, itemRawString:
+		name = t.parseTemplateName(token, context)
+	default:
+		nameExpr = t.dynamicTemplateName(token, context)
+	}
+	pipe, args := t.templateArgs(context, false)
+	node := t.newTemplate(token.pos, token.line, name, pipe)
+	node.NameExpr = nameExpr
+	node.Args = args
+	return node
+}
+
+// templateArgs parses the pipeline and the named arguments of a template invocation:
+//	pipeline? (name=operand)*
+// The right delimiter is consumed.
+func (t *Tree) templateArgs(context string, pipeRequired bool) (pipe *PipeNode, args []*NamedArg) {
+	t.namedArgs = true
+	defer func() { t.namedArgs = false }()
+	if !t.namedArgAhead() {
+		if !pipeRequired && t.peekNonSpace().typ == itemRightDelim {
+			t.nextNonSpace()
+			return
+		}
 		// Do not pop variables; they persist until "end".
 		pipe = t.pipeline(context)
+		if !t.namedArgs {
+			// The pipeline consumed the right delimiter.
+			return
+		}
+	}
+	return pipe, t.namedArgList(context, false)
+}
+
+// namedArgAhead reports whether the next tokens are the beginning of a named argument.
+func (t *Tree) namedArgAhead() bool {
+	token := t.nextNonSpace()
+	if token.typ != itemIdentifier {
+		t.backup()
+		return false
+	}
+	next := t.next()
+	t.backup2(token)
+	return next.typ == itemAssign
+}
+
+// namedArgList:
+//	(name=operand)*
+// The value is optional for parameter declarations. The right delimiter is consumed.
+func (t *Tree) namedArgList(context string, declaration bool) (args []*NamedArg) {
+	names := make(map[string]bool)
+	for {
+		token := t.nextNonSpace()
+		switch token.typ {
+		case itemRightDelim:
+			return
+		case itemIdentifier:
+		default:
+			t.unexpected(token, context)
+		}
+		if names[token.val] {
+			t.errorf("duplicate argument %s in %s", token.val, context)
+		}
+		names[token.val] = true
+		arg := &NamedArg{Pos: token.pos, Name: token.val}
+		if t.peek().typ == itemAssign {
+			t.next()
+			if arg.Value = t.operand(); arg.Value == nil {
+				t.errorf("missing value for argument %s in %s", token.val, context)
+			}
+		} else if !declaration {
+			t.errorf("missing value for argument %s in %s", token.val, context)
+		}
+		args = append(args, arg)
 	}
-	return t.newTemplate(token.pos, token.line, name, pipe)
+}
+
+// declareParams declares the parameters of the template as variables.
+func (t *Tree) declareParams(params []*NamedArg) {
+	t.Params = params
+	for _, param := range params {
+		t.vars = append(t.vars, "$"+param.Name)
+	}
+}
+
+// dynamicTemplateName parses the operand that gives the name of the template at execution time.
+func (t *Tree) dynamicTemplateName(token item, context string) Node {
+	t.backup()
+	switch node := t.operand(); node.(type) {
+	case *ChainNode, *DotNode, *FieldNode, *IdentifierNode, *PipeNode, *VariableNode:
+		return node
+	}
+	t.unexpected(token, context)
+	return nil
 }
 
 func (t *Tree) parseTemplateName(token item, context string) (name string) {
@@ -584,13 +1063,87 @@ func (t *Tree) parseTemplateName(token item, context string) (name string) {
 }
 
 // command:
-//	operand (space operand)*
-// space-separated arguments up to a pipeline character or right delimiter.
+//	expression
+// an expression up to a pipeline character or right delimiter.
 // we consume the pipe character but leave the right delim to terminate the action.
 func (t *Tree) command() *CommandNode {
+	pos := t.peekNonSpace().pos
+	node := t.expression(lowestPrecedence, item{})
+	cmd, ok := node.(*CommandNode)
+	if !ok {
+		cmd = t.newCommand(pos)
+		cmd.append(node)
+	}
+	switch token := t.next(); token.typ {
+	case itemPipe:
+	case itemOperator:
+		// A unary operator cannot follow an operand.
+		t.errorf("unexpected %s in operand", token)
+	default:
+		t.backup()
+	}
+	return cmd
+}
+
+// Precedence of the binary operators; the higher binds the tighter.
+const lowestPrecedence = 0
+
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+// expression:
+//	unary (operator unary)*
+// The binary operators bind less tightly than the application of a function
+// to its arguments. The operator preceding the expression, if any, is used
+// to report a missing operand.
+func (t *Tree) expression(prec int, op item) Node {
+	left := t.unary(op)
+	for {
+		token := t.peekNonSpace()
+		if token.typ != itemOperator || precedence[token.val] <= prec {
+			return left
+		}
+		t.nextNonSpace()
+		left = t.newExpr(token.pos, token.val, left, t.expression(precedence[token.val], token))
+	}
+}
+
+// unary:
+//	('!' | '-')* application
+func (t *Tree) unary(op item) Node {
+	token := t.peekNonSpace()
+	if token.typ == itemOperator && (token.val == "!" || token.val == "-") {
+		t.nextNonSpace()
+		return t.newExpr(token.pos, token.val, t.unary(token))
+	}
+	cmd := t.application()
+	if len(cmd.Args) == 0 {
+		if op.typ == itemOperator {
+			t.errorf("missing operand after %s", op)
+		}
+		if next := t.peekNonSpace(); next.typ == itemOperator {
+			t.errorf("missing operand before %s", next)
+		}
+		t.errorf("empty command")
+	}
+	return cmd
+}
+
+// application:
+//	operand (space operand)*
+// space-separated arguments up to an operator, a pipeline character or right delimiter.
+func (t *Tree) application() *CommandNode {
 	cmd := t.newCommand(t.peekNonSpace().pos)
 	for {
 		t.peekNonSpace() // skip leading spaces.
+		if t.namedArgs && t.namedArgAhead() {
+			break
+		}
 		operand := t.operand()
 		if operand != nil {
 			cmd.append(operand)
@@ -600,17 +1153,13 @@ func (t *Tree) command() *CommandNode {
 			continue
 		case itemError:
 			t.errorf("%s", token.val)
-		case itemRightDelim, itemRightParen:
+		case itemRightDelim, itemRightParen, itemPipe, itemOperator:
 			t.backup()
-		case itemPipe:
 		default:
 			t.errorf("unexpected %s in operand", token)
 		}
 		break
 	}
-	if len(cmd.Args) == 0 {
-		t.errorf("empty command")
-	}
 	return cmd
 }
 
@@ -715,6 +1264,27 @@ func (t *Tree) hasFunction(name string) bool {
 // popVars trims the variable list to the specified length
 func (t *Tree) popVars(n int) {
 	t.vars = t.vars[:n]
+	for len(t.loops) > 0 && t.loops[len(t.loops)-1] >= n {
+		t.loops = t.loops[:len(t.loops)-1]
+	}
+}
+
+// loopShadowed reports whether the innermost $loop variable in scope has been
+// declared by the template rather than by a range. Such a variable shadows the
+// $loop of the ranges in its scope.
+func (t *Tree) loopShadowed() bool {
+	for i := len(t.vars) - 1; i >= 0; i-- {
+		if t.vars[i] == "$loop" {
+			return len(t.loops) == 0 || t.loops[len(t.loops)-1] != i
+		}
+	}
+	return false
+}
+
+// declareLoop declares the $loop variable of a range body.
+func (t *Tree) declareLoop() {
+	t.loops = append(t.loops, len(t.vars))
+	t.vars = append(t.vars, "$loop")
 }
 
 // useVar returns a node for a variable reference. It errors if the
@@ -232,10 +232,63 @@ var parseTests = []parseTest{
 		`{{range $x, $y := .SI}}{{.}}{{end}}`},
 	{"constants", "{{range .SI 1 -3.2i true false 'a' nil}}{{end}}", noError,
 		`{{range .SI 1 -3.2i true false 'a' nil}}{{end}}`},
+	{"range with break", "{{range .SI}}{{.}}{{break}}{{end}}", noError,
+		`{{range .SI}}{{.}}{{break}}{{end}}`},
+	{"range with continue", "{{range .SI}}{{.}}{{continue}}{{end}}", noError,
+		`{{range .SI}}{{.}}{{continue}}{{end}}`},
+	{"capture", "{{capture $x}}a{{.X}}{{end}}{{$x}}", noError,
+		`{{capture $x}}"a"{{.X}}{{end}}{{$x}}`},
+	{"switch", "{{switch .X}} {{case 1 2}}a{{case .Y (printf `%d` 3)}}b{{default}}c{{end}}", noError,
+		"{{switch .X}}{{case 1 2}}\"a\"{{case .Y (printf `%d` 3)}}\"b\"{{default}}\"c\"{{end}}"},
+	{"switch with declaration", "{{switch $x := .X}}{{case $x.Y}}{{$x}}{{end}}", noError,
+		"{{switch $x := .X}}{{case $x.Y}}{{$x}}{{end}}"},
+	{"empty switch", "{{switch .X}}{{end}}", noError,
+		"{{switch .X}}{{end}}"},
+	{"switch with else", "{{switch .X}}{{case 1}}a{{else}}b{{end}}", noError,
+		"{{switch .X}}{{case 1}}\"a\"{{default}}\"b\"{{end}}"},
+	{"arithmetic", "{{.X+ 1*2 -3}}", noError,
+		`{{.X + 1 * 2 - 3}}`},
+	{"comparison", "{{if contains .X .Y>=2 && !.X||.Y-1}}a{{end}}", noError,
+		`{{if contains .X .Y >= 2 && !.X || .Y - 1}}"a"{{end}}`},
+	{"operator in pipeline", "{{$x := (.X + 1) * -.Y | printf `%d`}}", noError,
+		"{{$x := (.X + 1) * -.Y | printf `%d`}}"},
+	{"operator in argument", "{{printf `%d` (.X % 2 == 0)}}", noError,
+		"{{printf `%d` (.X % 2 == 0)}}"},
+	{"range with loop", "{{range .SI}}{{$loop.Index}}{{end}}", noError,
+		`{{range .SI}}{{$loop.Index}}{{end}}`},
+	{"range with declared loop", "{{$loop := 1}}{{range .SI}}{{$loop}}{{end}}", noError,
+		`{{$loop := 1}}{{range .SI}}{{$loop}}{{end}}`},
+	{"range declaring loop", "{{range $loop := .SI}}{{$loop}}{{end}}", noError,
+		`{{range $loop := .SI}}{{$loop}}{{end}}`},
+	{"break in if", "{{range .SI}}{{if .}}{{break}}{{end}}{{end}}", noError,
+		`{{range .SI}}{{if .}}{{break}}{{end}}{{end}}`},
+	{"counted break", "{{range .X}}{{range .Y}}{{break 2}}{{end}}{{end}}", noError,
+		`{{range .X}}{{range .Y}}{{break 2}}{{end}}{{end}}`},
+	{"counted continue", "{{range .X}}{{range .Y}}{{continue 2}}{{continue 1}}{{end}}{{end}}", noError,
+		`{{range .X}}{{range .Y}}{{continue 2}}{{continue}}{{end}}{{end}}`},
+	{"break outside range", "{{range .X}}{{end}}{{break}}", hasError, ""},
+	{"continue outside range", "{{range .X}}{{end}}{{continue}}", hasError, ""},
+	{"break in range else", "{{range .X}}{{else}}{{break}}{{end}}", hasError, ""},
+	{"break with pipeline", "{{range .X}}{{break .Y}}{{end}}", hasError, ""},
 	{"template", "{{template `x`}}", noError,
 		`{{template "x"}}`},
 	{"template with arg", "{{template `x` .Y}}", noError,
 		`{{template "x" .Y}}`},
+	{"template with named args", "{{template `x` title=.Name size=3}}", noError,
+		`{{template "x" title=.Name size=3}}`},
+	{"template with pipeline and named args", "{{template `x` .Y | printf `%v` title=(printf .Name) ok=true}}", noError,
+		"{{template \"x\" .Y | printf `%v` title=(printf .Name) ok=true}}"},
+	{"template with named arg and no value", "{{template `x` title=}}", hasError, ""},
+	{"template with named arg without value", "{{template `x` . title}}", hasError, ""},
+	{"define with params", "{{define `x` title size=3}}{{$title}}{{$size}}{{end}}", noError, ""},
+	{"block with named args", "{{block `x` title=.Name}}{{$title}}{{end}}", noError,
+		`{{template "x" title=.Name}}`},
+	{"template with dynamic name", "{{template .Kind .}}", noError,
+		`{{template .Kind .}}`},
+	{"template with variable name", "{{$n := `x`}}{{template $n.Name .Y}}", noError,
+		"{{$n := `x`}}{{template $n.Name .Y}}"},
+	{"template with pipeline name", "{{template (printf `row_%s` .Type) .}}", noError,
+		"{{template (printf `row_%s` .Type) .}}"},
 	{"with", "{{with .X}}hello{{end}}", noError,
 		`{{with .X}}"hello"{{end}}`},
 	{"with with else", "{{with .X}}hello{{else}}goodbye{{end}}", noError,
@@ -263,7 +316,10 @@ var parseTests = []parseTest{
 	{"variable undefined after end", "{{with $x := 4}}{{end}}{{$x}}", hasError, ""},
 	{"variable undefined in template", "{{template $v}}", hasError, ""},
 	{"declare with field", "{{with $x.Y := 4}}{{end}}", hasError, ""},
-	{"template with field ref", "{{template .X}}", hasError, ""},
+	{"template with field ref", "{{template .X}}", noError,
+		`{{template .X}}`},
+	{"template with constant name", "{{template 3}}", hasError, ""},
+	{"template with nil name", "{{template nil .}}", hasError, ""},
 	{"template with var", "{{template $v}}", hasError, ""},
 	{"invalid punctuation", "{{printf 3, 4}}", hasError, ""},
 	{"multidecl outside range", "{{with $v, $u := 3}}{{end}}", hasError, ""},
@@ -281,7 +337,7 @@ var parseTests = []parseTest{
 	{"bug0e", "{{range $x := $y := 3}}{{end}}", hasError, ""},
 	// Another bug: variable read must ignore following punctuation.
 	{"bug1a", "{{$x:=.}}{{$x!2}}", hasError, ""},                     // ! is just illegal here.
-	{"bug1b", "{{$x:=.}}{{$x+2}}", hasError, ""},                     // $x+2 should not parse as ($x) (+2).
+	{"bug1b", "{{$x:=.}}{{$x+2}}", noError, "{{$x := .}}{{$x + 2}}"}, // $x+2 is an addition, not ($x) (+2).
 	{"bug1c", "{{$x:=.}}{{$x +2}}", noError, "{{$x := .}}{{$x +2}}"}, // It's OK with a space.
 	// dot following a literal value
 	{"dot after integer", "{{1.E}}", hasError, ""},
@@ -467,6 +523,90 @@ var errorTests = []parseTest{
 	{"rangeundefvar",
 		"{{range $k}}{{end}}",
 		hasError, `undefined variable`},
+	{"loopoutsiderange",
+		"{{range .SI}}{{end}}{{$loop}}",
+		hasError, `undefined variable "$loop"`},
+	{"superoutsideblock",
+		`{{extends "base"}}{{super}}`,
+		hasError, `{{super}} outside a {{block}} of an extending template`},
+	{"superwithoutextends",
+		`{{block "x" .}}{{super}}{{end}}`,
+		hasError, `{{super}} outside a {{block}} of an extending template`},
+	{"extendsafterblock",
+		`{{block "x" .}}{{end}}{{extends "base"}}`,
+		hasError, `{{extends}} must precede the content of the template`},
+	{"textafterextends",
+		`{{extends "base"}} {{block "x" .}}{{end}} x`,
+		hasError, `only spaces and {{block}} are allowed after {{extends}} in template "textafterextends"`},
+	{"actionafterextends",
+		`{{extends "base"}}{{.Missing.X}}`,
+		hasError, `only spaces and {{block}} are allowed after {{extends}} in template "actionafterextends"`},
+	{"extendsnested",
+		`{{if .X}}{{extends "base"}}{{end}}`,
+		hasError, `{{extends}} must be at the top level of the template`},
+	{"multipleextends",
+		`{{extends "a"}}{{extends "b"}}`,
+		hasError, `multiple {{extends}} in template "multipleextends"`},
+	{"duplicateblock",
+		`{{extends "base"}}{{block "x" .}}{{end}}{{block "x" .}}{{end}}`,
+		hasError, `multiple definition of block "x"`},
+	{"capturenovariable",
+		"{{capture .X}}{{end}}",
+		hasError, `unexpected ".X" in capture clause`},
+	{"capturefieldvariable",
+		"{{capture $x.Y}}{{end}}",
+		hasError, `unexpected ".Y" in capture clause`},
+	{"captureinbody",
+		"{{capture $x}}{{$x}}{{end}}",
+		hasError, `undefined variable "$x"`},
+	{"capturebodyvariable",
+		"{{capture $x}}{{$y := 1}}{{end}}{{$y}}",
+		hasError, `undefined variable "$y"`},
+	{"switchtext",
+		"{{switch .X}}a{{case 1}}{{end}}",
+		hasError, `only spaces are allowed before the first {{case}} in switch`},
+	{"caseafterdefault",
+		"{{switch .X}}{{default}}{{case 1}}{{end}}",
+		hasError, `{{case}} after {{default}} in switch`},
+	{"multipledefault",
+		"{{switch .X}}{{default}}{{default}}{{end}}",
+		hasError, `multiple {{default}} in switch`},
+	{"switchelseif",
+		"{{switch .X}}{{case 1}}{{else if .Y}}{{end}}{{end}}",
+		hasError, `{{else if}} in switch`},
+	{"casewithoutvalue",
+		"{{switch .X}}{{case}}{{end}}",
+		hasError, `missing value for case`},
+	{"casepipeline",
+		"{{switch .X}}{{case .Y | .Z}}{{end}}",
+		hasError, `unexpected "|" in case`},
+	{"caseoutsideswitch",
+		"{{case 1}}",
+		hasError, `unexpected {{case 1}}`},
+	{"caseinif",
+		"{{switch .X}}{{case 1}}{{if .Y}}{{case 2}}{{end}}{{end}}",
+		hasError, `unexpected {{case 2}} in if`},
+	{"defaultoutsideswitch",
+		"{{if .X}}{{default}}{{end}}",
+		hasError, `unexpected {{default}} in if`},
+	{"trywithouttrap",
+		"{{try}}{{end}}",
+		hasError, `{{try}} requires the Trap option`},
+	{"catchoutsidetry",
+		"{{if .X}}{{catch $err}}{{end}}",
+		hasError, `unexpected {{catch $err}} in if`},
+	{"missingoperand",
+		"{{.X +}}",
+		hasError, `missing operand after "+"`},
+	{"missingleftoperand",
+		"{{* .X}}",
+		hasError, `missing operand before "*"`},
+	{"operatorinarguments",
+		"{{.X !.Y}}",
+		hasError, `unexpected "!" in operand`},
+	{"expressionpiped",
+		"{{.X | .Y + 1}}",
+		hasError, `non executable command in pipeline stage 2`},
 	{"rangeundefvars",
 		"{{range $k, $v}}{{end}}",
 		hasError, `undefined variable`},
@@ -482,6 +622,129 @@ var errorTests = []parseTest{
 	{"rangenotvariable2",
 		"{{range $k, 123 := .}}{{end}}",
 		hasError, `range can only initialize variables`},
+	{"duplicate named argument",
+		"{{template `x` a=1 a=2}}",
+		hasError, `duplicate argument a in template clause`},
+	{"missing named argument value",
+		"{{template `x` . a=}}",
+		hasError, `missing value for argument a in template clause`},
+	{"undeclared parameter",
+		"{{define `x` a}}{{$b}}{{end}}",
+		hasError, `undefined variable "$b"`},
+	{"bad parameter",
+		"{{define `x` .A}}{{end}}",
+		hasError, `unexpected ".A" in define clause`},
+	{"named argument in command",
+		"{{.X a=1}}",
+		hasError, `function "a" not defined`},
+	{"break outside range",
+		"{{if .X}}{{break}}{{end}}",
+		hasError, `{{break}} outside {{range}}`},
+	{"continue outside range",
+		"{{range .X}}{{end}}{{continue}}",
+		hasError, `{{continue}} outside {{range}}`},
+	{"break in define",
+		"{{range .X}}{{end}}{{define `x`}}{{break}}{{end}}",
+		hasError, `{{break}} outside {{range}}`},
+	{"break too deep",
+		"{{range .X}}{{range .Y}}{{break 3}}{{end}}{{end}}",
+		hasError, `break 3 exceeds the 2 enclosing {{range}}`},
+	{"continue zero",
+		"{{range .X}}{{continue 0}}{{end}}",
+		hasError, `invalid {{continue}} levels: 0`},
+	{"break with pipeline",
+		"{{range .X}}{{break .Y}}{{end}}",
+		hasError, `unexpected ".Y" in {{break}}`},
+}
+
+func TestBreakAndContinueFunctions(t *testing.T) {
+	// Functions named break or continue take precedence over the keywords.
+	funcs := map[string]interface{}{"break": func(int) int { return 0 }, "continue": func() int { return 0 }}
+	tree, err := New("funcs").Parse("{{break 20}}{{range .X}}{{continue}}{{end}}", "", "", make(map[string]*Tree), funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.Root.String(), "{{break 20}}{{range .X}}{{continue}}{{end}}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if typ := tree.Root.Nodes[0].Type(); typ != NodeAction {
+		t.Errorf("break: got node type %d, want action", typ)
+	}
+	if typ := tree.Root.Nodes[1].(*RangeNode).List.Nodes[0].Type(); typ != NodeAction {
+		t.Errorf("continue: got node type %d, want action", typ)
+	}
+}
+
+func TestSwitchWithDefaultFunction(t *testing.T) {
+	// A function named default takes precedence over the keyword, {{else}} replaces {{default}}.
+	funcs := map[string]interface{}{"default": func(string, string) string { return "" }}
+	tree, err := New("funcs").Parse("{{switch .X}}{{case 1}}{{default `a` .Y}}{{else}}b{{end}}", "", "", make(map[string]*Tree), funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tree.Root.String(), "{{switch .X}}{{case 1}}{{default `a` .Y}}{{default}}b{{end}}"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTry(t *testing.T) {
+	funcs := map[string]interface{}{"trap": func() string { return "" }}
+	tests := []struct {
+		name, input, result string
+	}{
+		{"try", "{{try}}a{{end}}", `{{try}}"a"{{end}}`},
+		{"catch", "{{try}}a{{catch}}b{{end}}", `{{try}}"a"{{catch}}"b"{{end}}`},
+		{"catch variable", "{{try}}{{$x := 1}}{{catch $err}}{{$err}}{{end}}", `{{try}}{{$x := 1}}{{catch $err}}{{$err}}{{end}}`},
+		{"try variable", "{{try}}{{$x := 1}}{{catch}}{{$x}}{{end}}", `undefined variable "$x"`},
+		{"catch variable scope", "{{try}}{{catch $err}}{{end}}{{$err}}", `undefined variable "$err"`},
+		{"multiple catch", "{{try}}{{catch}}{{catch}}{{end}}", `unexpected {{catch}} in try`},
+		{"catch field", "{{try}}{{catch $err.X}}{{end}}", `unexpected ".X" in catch`},
+	}
+	textFormat = "%q"
+	defer func() { textFormat = "%s" }()
+	for _, test := range tests {
+		tree, err := New(test.name).Parse(test.input, "", "", make(map[string]*Tree), funcs)
+		var result string
+		if err != nil {
+			result = err.Error()
+		} else {
+			result = tree.Root.String()
+		}
+		if !strings.Contains(result, test.result) {
+			t.Errorf("%s: got %q, want %q", test.name, result, test.result)
+		}
+		if err == nil && tree.Root.Copy().String() != result {
+			t.Errorf("%s: copy differs: %q", test.name, tree.Root.Copy())
+		}
+	}
+}
+
+func TestExtends(t *testing.T) {
+	treeSet := make(map[string]*Tree)
+	text := `{{define "helper"}}h{{end}}{{extends "base"}}{{block "title" .}}T{{super}}{{end}} {{block "body" .}}{{block "inner" .}}I{{end}}{{end}}`
+	tree, err := New("child").Parse(text, "", "", treeSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Extends != "base" {
+		t.Errorf("extends: got %q, want %q", tree.Extends, "base")
+	}
+	for name, want := range map[string]string{"title": "T{{super}}", "body": `{{template "inner" .}}`, "inner": "I"} {
+		if block := tree.Blocks[name]; block == nil {
+			t.Errorf("block %q not defined", name)
+		} else if got := block.Root.String(); got != want {
+			t.Errorf("block %q: got %q, want %q", name, got, want)
+		}
+		if treeSet[name] != nil {
+			t.Errorf("block %q added to the tree set", name)
+		}
+	}
+	if treeSet["helper"] == nil {
+		t.Errorf("definition not added to the tree set")
+	}
+	if copied := tree.Copy(); copied.Extends != "base" || len(copied.Blocks) != 3 || copied.Blocks["title"] == tree.Blocks["title"] {
+		t.Errorf("copy: extends %q, blocks %v", copied.Extends, copied.Blocks)
+	}
 }
 
 func TestErrors(t *testing.T) {
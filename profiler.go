@@ -0,0 +1,141 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jocgir/template/parse"
+)
+
+// Profiler is a Tracer that accumulates the time spent in each template and in each function.
+// Template times include the time spent in the templates and functions they invoke.
+//
+//   profiler := template.NewProfiler()
+//   t.Option(profiler)
+//   ...
+//   profiler.WriteReport(os.Stderr)
+type Profiler struct {
+	mu        sync.Mutex
+	templates map[string]*ProfileEntry
+	functions map[string]*ProfileEntry
+}
+
+// ProfileEntry holds the accumulated measures for a template or a function.
+type ProfileEntry struct {
+	Name   string
+	Count  int           // Number of invocations.
+	Errors int           // Number of invocations that failed.
+	Total  time.Duration // Total time spent.
+	Max    time.Duration // Longest invocation.
+}
+
+// Average returns the average time spent by invocation.
+func (e ProfileEntry) Average() time.Duration {
+	if e.Count == 0 {
+		return 0
+	}
+	return e.Total / time.Duration(e.Count)
+}
+
+func (e *ProfileEntry) add(duration time.Duration, err error) {
+	e.Count++
+	e.Total += duration
+	if duration > e.Max {
+		e.Max = duration
+	}
+	if err != nil {
+		e.Errors++
+	}
+}
+
+// NewProfiler creates a new Profiler.
+func NewProfiler() *Profiler {
+	p := &Profiler{}
+	p.Reset()
+	return p
+}
+
+// Reset discards the accumulated measures.
+func (p *Profiler) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.templates = make(map[string]*ProfileEntry)
+	p.functions = make(map[string]*ProfileEntry)
+}
+
+// Templates returns the measures by template, sorted by decreasing total time.
+func (p *Profiler) Templates() []ProfileEntry { return p.sorted(templateEntries) }
+
+// Functions returns the measures by function, sorted by decreasing total time.
+func (p *Profiler) Functions() []ProfileEntry { return p.sorted(functionEntries) }
+
+// WriteReport writes a tabular report of the accumulated measures to w.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Kind\tName\tCount\tErrors\tTotal\tAverage\tMax\t")
+	for _, kind := range []struct {
+		name    string
+		entries []ProfileEntry
+	}{{"template", p.Templates()}, {"function", p.Functions()}} {
+		for _, e := range kind.entries {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\t%v\t%v\t\n", kind.name, e.Name, e.Count, e.Errors, e.Total, e.Average(), e.Max)
+		}
+	}
+	return tw.Flush()
+}
+
+// The maps of entries are swapped by Reset, they are selected once the profiler is locked.
+func templateEntries(p *Profiler) map[string]*ProfileEntry { return p.templates }
+func functionEntries(p *Profiler) map[string]*ProfileEntry { return p.functions }
+
+func (p *Profiler) sorted(selector func(*Profiler) map[string]*ProfileEntry) []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := selector(p)
+	result := make([]ProfileEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (p *Profiler) add(selector func(*Profiler) map[string]*ProfileEntry, name string, duration time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := selector(p)
+	entry := entries[name]
+	if entry == nil {
+		entry = &ProfileEntry{Name: name}
+		entries[name] = entry
+	}
+	entry.add(duration, err)
+}
+
+// TraceNode implements Tracer.
+func (p *Profiler) TraceNode(*Template, parse.Node) {}
+
+// TraceCall implements Tracer.
+func (p *Profiler) TraceCall(_ *Template, call CallTrace) {
+	p.add(functionEntries, call.Name, call.Duration, call.Err)
+}
+
+// TraceEnter implements Tracer.
+func (p *Profiler) TraceEnter(*Template) {}
+
+// TraceExit implements Tracer.
+func (p *Profiler) TraceExit(t *Template, duration time.Duration, err error) {
+	p.add(templateEntries, t.Name(), duration, err)
+}
+
+// TraceRecover implements Tracer.
+func (p *Profiler) TraceRecover(*Context, string, ErrorAction) {}
@@ -0,0 +1,180 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jocgir/template/parse"
+)
+
+// Sandbox restricts the fields, methods and functions reachable from a template.
+//
+// Once a sandbox is set on a template, a field or a method can only be accessed if its
+// receiver type has been allowed with AllowTypes or if the member has been explicitly
+// allowed with AllowFields or AllowMethods. Map entries are always accessible, as well
+// as the members of the types provided by the package to the templates: Loop and the
+// ExecError caught by {{try}}.
+//
+// Registered functions and builtins remain available, except call and eval that must
+// be explicitly allowed with AllowFunctions. If AllowFunctions is used, only the listed
+// functions and the builtins (still excluding call) are available.
+//
+//   sandbox := template.NewSandbox().
+//     AllowTypes(Invoice{}).
+//     AllowMethods(&Customer{}, "FullName").
+//     AllowFields(Customer{}, "Email")
+//   t := template.New("customer").Option(sandbox)
+type Sandbox struct {
+	types     map[reflect.Type]bool
+	fields    map[reflect.Type]map[string]bool
+	methods   map[reflect.Type]map[string]bool
+	functions map[string]bool
+}
+
+// NewSandbox creates a Sandbox that denies access to all fields and methods.
+func NewSandbox() *Sandbox {
+	return &Sandbox{
+		types:   make(map[reflect.Type]bool),
+		fields:  make(map[reflect.Type]map[string]bool),
+		methods: make(map[reflect.Type]map[string]bool),
+	}
+}
+
+// AllowTypes allows access to all exported fields and methods of the supplied types.
+// Types can be supplied as reflect.Type or as sample values.
+func (sb *Sandbox) AllowTypes(types ...interface{}) *Sandbox {
+	for _, typ := range types {
+		sb.types[sandboxType(typ)] = true
+	}
+	return sb
+}
+
+// AllowFields allows access to the named fields of the supplied type.
+// The type can be supplied as reflect.Type or as a sample value.
+func (sb *Sandbox) AllowFields(typ interface{}, fields ...string) *Sandbox {
+	allowMembers(sb.fields, sandboxType(typ), fields)
+	return sb
+}
+
+// AllowMethods allows calling the named methods of the supplied type.
+// The type can be supplied as reflect.Type or as a sample value.
+func (sb *Sandbox) AllowMethods(typ interface{}, methods ...string) *Sandbox {
+	allowMembers(sb.methods, sandboxType(typ), methods)
+	return sb
+}
+
+// AllowFunctions allows calling the named functions. Once called, only the listed
+// functions and the builtins are available. It is required to allow call and eval.
+func (sb *Sandbox) AllowFunctions(names ...string) *Sandbox {
+	if sb.functions == nil {
+		sb.functions = make(map[string]bool)
+	}
+	for _, name := range names {
+		sb.functions[name] = true
+	}
+	return sb
+}
+
+func allowMembers(members map[reflect.Type]map[string]bool, typ reflect.Type, names []string) {
+	if members[typ] == nil {
+		members[typ] = make(map[string]bool)
+	}
+	for _, name := range names {
+		members[typ][name] = true
+	}
+}
+
+// sandboxType returns the type designated by the argument, pointers being ignored.
+func sandboxType(typ interface{}) reflect.Type {
+	t, ok := typ.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(typ)
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// packageTypes are the types provided by the package to the templates, always allowed.
+var packageTypes = map[reflect.Type]bool{
+	sandboxType(loopType):       true,
+	reflect.TypeOf(ExecError{}): true,
+	reflect.TypeOf(StackCall{}): true,
+}
+
+func (sb *Sandbox) allowMember(members map[reflect.Type]map[string]bool, typ reflect.Type, name string) bool {
+	typ = sandboxType(typ)
+	return sb.types[typ] || members[typ][name] || packageTypes[typ]
+}
+
+func (sb *Sandbox) allowFunction(name string) bool {
+	switch {
+	case sb.functions[name]:
+		return true
+	case name == "call" || name == "eval":
+		return false
+	case sb.functions == nil:
+		return true
+	}
+	_, isBuiltin := builtins[name]
+	return isBuiltin
+}
+
+// ErrAccessDenied is the error matched by errors.Is for all sandbox violations.
+var ErrAccessDenied = errors.New("access denied")
+
+// SandboxError is the error raised when a template tries to reach a member or
+// a function that is not allowed by the sandbox.
+type SandboxError struct {
+	Kind string       // Kind of access: field, method or function.
+	Name string       // Name of the member or the function.
+	Type reflect.Type // Receiver type (nil for functions).
+}
+
+func (e *SandboxError) Error() string {
+	if e.Type == nil {
+		return fmt.Sprintf("%v to %s %q", ErrAccessDenied, e.Kind, e.Name)
+	}
+	return fmt.Sprintf("%v to %s %s of type %s", ErrAccessDenied, e.Kind, e.Name, e.Type)
+}
+
+// Is makes SandboxError match ErrAccessDenied.
+func (e *SandboxError) Is(target error) bool { return target == ErrAccessDenied }
+
+func isSandboxError(err error) bool { return errors.Is(err, ErrAccessDenied) }
+
+// sandboxMember returns an error if the sandbox denies access to the member of the type.
+func (s *state) sandboxMember(kind string, typ reflect.Type, name string) error {
+	sb := s.tmpl.option.sandbox
+	if sb == nil {
+		return nil
+	}
+	members := sb.fields
+	if kind == "method" {
+		members = sb.methods
+	}
+	if sb.allowMember(members, typ, name) {
+		return nil
+	}
+	return &SandboxError{kind, name, typ}
+}
+
+// sandboxFunction returns an error if the sandbox denies calling the named function.
+func (s *state) sandboxFunction(name string) error {
+	if sb := s.tmpl.option.sandbox; sb != nil && !sb.allowFunction(name) {
+		return &SandboxError{"function", name, nil}
+	}
+	return nil
+}
+
+// denied gives the error managers the opportunity to handle a sandbox violation.
+// If the violation is not handled, processing is terminated.
+func (s *state) denied(err error, name string, node parse.Node, args []parse.Node, fun, dot, final, receiver reflect.Value) reflect.Value {
+	var result reflect.Value
+	if err = s.result(Denied, err, name, node, args, fun, dot, final, receiver, &result); err != nil {
+		s.errorf("%w", err)
+	}
+	return result
+}
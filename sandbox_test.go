@@ -0,0 +1,128 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sandboxCustomer struct {
+	Name   string
+	Email  string
+	Secret string
+}
+
+func (c *sandboxCustomer) Greeting() string { return "Hello " + c.Name }
+func (c *sandboxCustomer) Delete() string   { return "deleted" }
+
+type sandboxInvoice struct {
+	Customer *sandboxCustomer
+	Total    int
+	Lines    []int
+	Action   func() string
+}
+
+func TestSandbox(t *testing.T) {
+	t.Parallel()
+
+	data := &sandboxInvoice{
+		Customer: &sandboxCustomer{"John", "john@example.com", "pwd"},
+		Total:    10,
+		Lines:    []int{1, 2},
+		Action:   func() string { return "called" },
+	}
+	sandbox := func() *Sandbox {
+		return NewSandbox().
+			AllowTypes(sandboxInvoice{}).
+			AllowFields(&sandboxCustomer{}, "Name", "Email").
+			AllowMethods(sandboxCustomer{}, "Greeting")
+	}
+	handled := ErrorManagers{
+		NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
+			context.ClearError()
+			return fmt.Sprintf("<%s denied>", context.MemberName()), ResultReplaced
+		}).OnSources(Denied),
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		sandbox  *Sandbox
+		handlers ErrorManagers
+		result   string
+		err      string
+	}{
+		{"No sandbox", `{{.Customer.Delete}}`, nil, nil, "deleted", ""},
+		{"Allowed type", `{{.Total}}`, sandbox(), nil, "10", ""},
+		{"Allowed fields", `{{.Customer.Name}} {{.Customer.Email}}`, sandbox(), nil, "John john@example.com", ""},
+		{"Allowed method", `{{.Customer.Greeting}}`, sandbox(), nil, "Hello John", ""},
+		{"Map entries", `{{.key}}`, sandbox(), nil, "value", ""},
+		{"Builtins", `{{len "abc"}} {{upper "abc"}}`, sandbox(), nil, "3 ABC", ""},
+		{"Caught error", `{{try}}{{index .Lines 5}}{{catch $e}}{{$e.Line}} {{$e.Cause}}{{end}}`, sandbox(), nil, "1 error calling index: index out of range: 5", ""},
+		{"Loop", `{{range .Lines}}{{$loop.Index}}{{$loop.Even}} {{end}}`, sandbox(), nil, "0false 1true ", ""},
+		{
+			"Denied field", `{{.Customer.Secret}}`, sandbox(), nil, "",
+			`template: t:1:11: executing "t" at <.Customer.Secret>: access denied to field Secret of type template.sandboxCustomer`,
+		},
+		{
+			"Denied method", `{{.Customer.Delete}}`, sandbox(), nil, "",
+			`template: t:1:11: executing "t" at <.Customer.Delete>: access denied to method Delete of type *template.sandboxCustomer`,
+		},
+		{
+			"Denied type", `{{.Customer.Name}}`, NewSandbox(), nil, "",
+			`template: t:1:11: executing "t" at <.Customer.Name>: access denied to field Customer of type template.sandboxInvoice`,
+		},
+		{
+			"Denied call", `{{call .Action}}`, sandbox(), nil, "",
+			`template: t:1:2: executing "t" at <call>: access denied to function "call"`,
+		},
+		{"Allowed call", `{{call .Action}}`, sandbox().AllowFunctions("call"), nil, "called", ""},
+		{
+			"Denied eval", `{{eval "{{1}}"}}`, sandbox(), nil, "",
+			`template: t:1:2: executing "t" at <eval>: access denied to function "eval"`,
+		},
+		{"Allowed eval", `{{eval "{{1}}"}}`, sandbox().AllowFunctions("eval"), nil, "1", ""},
+		{
+			"Function not listed", `{{upper "abc"}}`, sandbox().AllowFunctions("eval"), nil, "",
+			`template: t:1:2: executing "t" at <upper>: access denied to function "upper"`,
+		},
+		{
+			"Denied in trap", `{{trap .Customer.Delete}}`, sandbox(), nil, "",
+			`template: t:1:16: executing "t" at <.Customer.Delete>: access denied to method Delete of type *template.sandboxCustomer`,
+		},
+		{"Handled", `{{.Customer.Delete}} {{call .Action}}`, sandbox(), handled, "<Delete denied> <call denied>", ""},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := New("t").Option(AllOptions).ErrorManagers("sandbox", tc.handlers...).Funcs(FuncMap{
+				"upper": func(s string) string { return fmt.Sprintf("%s", bytes.ToUpper([]byte(s))) },
+			})
+			if tc.sandbox != nil {
+				tmpl.Option(tc.sandbox)
+			}
+			tmpl = Must(tmpl.Parse(tc.input))
+
+			var data interface{} = data
+			if tc.name == "Map entries" {
+				data = Map{"key": "value"}
+			}
+			buffer := new(bytes.Buffer)
+			err := tmpl.Execute(buffer, data)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.True(t, errors.Is(err, ErrAccessDenied))
+				var sandboxError *SandboxError
+				assert.True(t, errors.As(err, &sandboxError))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.result, buffer.String())
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package template
+
+import (
+	"context"
+	"reflect"
+)
+
+type dynamicScopeKey struct{}
+
+// WithDynamicScope returns a copy of ctx that enables or disables dynamic scoping for the executions using it.
+// It takes precedence over the DynamicScope option set on the template.
+func WithDynamicScope(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, dynamicScopeKey{}, enabled)
+}
+
+// scope holds the variables visible to an invoked template through dynamic scoping.
+// Inner variables are last.
+type scope struct {
+	vars []variable
+}
+
+// scope returns the initial scope of an execution of t, nil if dynamic scoping is disabled.
+func (t *Template) scope(ctx context.Context) *scope {
+	enabled, set := ctx.Value(dynamicScopeKey{}).(bool)
+	if !set && t.common != nil {
+		enabled = t.option.dynamicScope
+	}
+	if !enabled {
+		return nil
+	}
+	return &scope{}
+}
+
+// callerScope returns the scope of a template invoked by s: the variables visible by s,
+// including its own variables except $.
+func (s *state) callerScope() *scope {
+	if s.scope == nil {
+		return nil
+	}
+	vars := make([]variable, 0, len(s.scope.vars)+len(s.vars)-1)
+	vars = append(vars, s.scope.vars...)
+	return &scope{append(vars, s.vars[1:]...)}
+}
+
+// lookup returns the value of the innermost variable with the given name.
+func (sc *scope) lookup(name string) (reflect.Value, bool) {
+	if sc == nil {
+		return reflect.Value{}, false
+	}
+	for i := len(sc.vars) - 1; i >= 0; i-- {
+		if sc.vars[i].name == name {
+			return sc.vars[i].value, true
+		}
+	}
+	return reflect.Value{}, false
+}
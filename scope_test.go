@@ -0,0 +1,61 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamicScope(t *testing.T) {
+	t.Parallel()
+
+	const defines = `
+		{{- define "header" locale user }}{{ $locale }}/{{ $user }}{{ end -}}
+		{{- define "layout" }}<{{ template "header" }}>{{ end -}}
+		{{- define "default" locale="en" }}{{ $locale }}{{ end -}}
+		{{- define "assign" locale }}{{ $locale = "de" }}{{ $locale }}{{ end -}}
+		{{- define "params" locale }}{{ template "header" }}{{ end -}}`
+
+	tests := []struct {
+		name    string
+		input   string
+		enabled bool
+		ctx     *bool
+		result  string
+	}{
+		{"Disabled", `{{ $locale := "fr" }}{{ template "header" }}`, false, nil, "<no value>/<no value>"},
+		{"Enabled", `{{ $locale := "fr" }}{{ $user := "bob" }}{{ template "header" }}`, true, nil, "fr/bob"},
+		{"Transitive", `{{ $locale := "fr" }}{{ $user := "bob" }}{{ template "layout" }}`, true, nil, "<fr/bob>"},
+		{"Named argument first", `{{ $locale := "fr" }}{{ template "header" locale="it" }}`, true, nil, "it/<no value>"},
+		{"Caller before default", `{{ template "default" }}{{ $locale := "fr" }}{{ template "default" }}`, true, nil, "enfr"},
+		{"Inner variable", `{{ $locale := "fr" }}{{ with $locale := "a" }}{{ template "default" }}{{ end }}`, true, nil, "a"},
+		{"Read only", `{{ $locale := "fr" }}{{ template "assign" }}{{ $locale }}`, true, nil, "defr"},
+		{"Through parameters", `{{ $user := "bob" }}{{ template "params" locale="fr" }}`, true, nil, "fr/bob"},
+		{"Include", `{{ $locale := "fr" }}{{ include "default" }}`, true, nil, "fr"},
+		{"Enabled by context", `{{ $locale := "fr" }}{{ template "default" }}`, false, newBool(true), "fr"},
+		{"Disabled by context", `{{ $locale := "fr" }}{{ template "default" }}`, true, newBool(false), "en"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl := New("t").Option(FlowControl)
+			if tt.enabled {
+				tmpl.Option(DynamicScope)
+			}
+			tmpl = Must(tmpl.Parse(defines + tt.input))
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = WithDynamicScope(ctx, *tt.ctx)
+			}
+			var buffer bytes.Buffer
+			assert.NoError(t, tmpl.ExecuteContext(ctx, &buffer, nil))
+			assert.Equal(t, tt.result, buffer.String())
+		})
+	}
+}
+
+func newBool(value bool) *bool { return &value }
@@ -3,29 +3,33 @@ package template
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/jocgir/template/parse"
 )
 
 // StackCall returns information about a stack element.
 type StackCall struct {
-	Name     string
-	Function reflect.Type
+	Name     string       // Name of the function or of the invoked template.
+	Function reflect.Type // Type of the function, nil for a {{template}} invocation.
 }
 
+// IsTemplate returns true if the stack element is a {{template}} invocation.
+func (c StackCall) IsTemplate() bool { return c.Function == nil }
+
 func (s *state) recover(f func(error) error) { s.recovered(recover(), f) }
 
 func (s *state) recovered(rec interface{}, f func(error) error) {
 	var err = asError(rec)
-	if f != nil {
+	if f != nil && !s.fatal(err) {
 		err = f(err)
 	}
 	switch err := err.(type) {
 	case nil:
-	case ExecError, flowControl:
+	case ExecError, flowControl, loopControl:
 		panic(err)
 	default:
-		s.errorf(err.Error())
+		s.errorf("%w", err)
 	}
 }
 
@@ -57,6 +61,9 @@ func (s *state) result(source ContextSource, err error, name string, node parse.
 func (s *state) invokeWithContext(name string, node parse.Node, args []parse.Node,
 	fun, dot, final, receiver reflect.Value, result *reflect.Value) {
 	context := s.newContext(CallContext, nil, name, node, args, fun, dot, final, receiver, result)
+	if s.tracer != nil {
+		defer s.traceCallPanic(name, node, time.Now())
+	}
 	defer s.recover(nil)
 	*result = reflect.ValueOf(context.Call(nil))
 	if err := context.Error(); err != nil {
@@ -68,20 +75,26 @@ func (s *state) format(source ContextSource, node parse.Node, iface interface{})
 	if s.hasErrorManagers() {
 		result := reflect.ValueOf(iface)
 		if err := s.newContext(source, nil, "", node, nil, nilv, nilv, nilv, result, &result).tryRecover(); err != nil {
-			s.errorf(err.Error())
+			s.errorf("%w", err)
 		}
 		return result.Interface()
 	}
 	return iface
 }
 
+// fatal reports whether the error must stop the execution without being submitted to error handlers.
+func (s *state) fatal(err error) bool {
+	return s.cancelled(err) || isLimitError(err) || isSandboxError(err)
+}
+
 func (s *state) hasErrorManagers() bool     { return len(s.tmpl.errorHandlers.managers) > 0 }
 func (s *state) peekStack(n int) *StackCall { return s.stack[len(s.stack)-n-1] }
 func (s *state) errorHandled(err error) bool {
-	if _, isFlowControl := err.(flowControl); isFlowControl {
+	switch err.(type) {
+	case flowControl, loopControl:
 		return true
 	}
-	return len(s.stack) > 1 && s.peekStack(1).Name == "trap"
+	return len(s.stack) > 1 && !s.peekStack(1).IsTemplate() && s.peekStack(1).Name == "trap"
 }
 
 func (s *state) variables() Map {
@@ -103,6 +116,18 @@ func (s *state) popStack() (result *StackCall) {
 	return
 }
 
+// callStack returns a copy of the current stack.
+func (s *state) callStack() []StackCall {
+	if len(s.stack) == 0 {
+		return nil
+	}
+	result := make([]StackCall, len(s.stack))
+	for i := range s.stack {
+		result[i] = *s.stack[i]
+	}
+	return result
+}
+
 func isValid(value reflect.Value) bool {
 	return value.IsValid() && value.CanInterface() && value.Interface() != nil
 }
@@ -21,28 +21,73 @@ func (t *Template) MustExecute(text string, data interface{}) string {
 
 // ErrorManagers allows registration of error handlers to manage errors.
 // An error handler is a packaged error handler function with preset filters for mode and source.
+// The managers are registered with DefaultPriority (see ErrorManagersPriority), so they are
+// evaluated after the built-in managers, whatever their id.
+//
+// Compatibility note: the managers used to be evaluated in the lexical order of their ids,
+// so an id sorting before the ones of the built-in managers (such as an id starting with a
+// digit or an uppercase letter) ran before them. Such managers must now be registered with
+// ErrorManagersPriority and a priority lower than the one of the built-in manager to precede:
+//   t.ErrorManagersPriority("id", template.FuncsAsMethodsPriority-1, manager)
 //
 // Is is possible to deregister a previously added error manager by simply calling this method
 // with the id of the manager to remove without managers.
 //   t.ErrorManagers("id to remove")
 func (t *Template) ErrorManagers(name string, managers ...*ErrorManager) *Template {
-	if t.errorHandlers.managers == nil {
-		t.errorHandlers.managers = make(map[string]ErrorManagers)
+	return t.ErrorManagersPriority(name, DefaultPriority, managers...)
+}
+
+// ErrorManagersPriority registers error managers as ErrorManagers does but with an explicit priority.
+// Managers are evaluated by ascending priority, then by lexical order of their ids.
+// The built-in managers use FuncsAsMethodsPriority, ContextPriority and CallFailPriority:
+//   t.ErrorManagersPriority("before context", template.ContextPriority-1, manager)
+func (t *Template) ErrorManagersPriority(name string, priority int, managers ...*ErrorManager) *Template {
+	handlers := &t.errorHandlers
+	if handlers.managers == nil {
+		handlers.managers = make(map[string]ErrorManagers)
+		handlers.priorities = make(map[string]int)
 	}
 	if len(managers) == 0 {
-		delete(t.errorHandlers.managers, name)
+		delete(handlers.managers, name)
+		delete(handlers.priorities, name)
 	} else {
-		t.errorHandlers.managers[name] = managers
+		handlers.managers[name] = managers
+		handlers.priorities[name] = priority
 	}
 
-	t.errorHandlers.keys = make([]string, 0, len(t.errorHandlers.managers))
-	for key := range t.errorHandlers.managers {
-		t.errorHandlers.keys = append(t.errorHandlers.keys, key)
+	handlers.keys = make([]string, 0, len(handlers.managers))
+	for key := range handlers.managers {
+		handlers.keys = append(handlers.keys, key)
 	}
-	sort.Strings(t.errorHandlers.keys)
+	sort.Slice(handlers.keys, func(i, j int) bool {
+		ki, kj := handlers.keys[i], handlers.keys[j]
+		if pi, pj := handlers.priorities[ki], handlers.priorities[kj]; pi != pj {
+			return pi < pj
+		}
+		return ki < kj
+	})
 	return t
 }
 
+// ErrorManagerGroup describes the error managers registered under an id.
+type ErrorManagerGroup struct {
+	ID       string
+	Priority int
+	Managers ErrorManagers
+}
+
+// ErrorManagerChain returns the registered error managers in the order they are evaluated.
+func (t *Template) ErrorManagerChain() []ErrorManagerGroup {
+	if t.common == nil {
+		return nil
+	}
+	result := make([]ErrorManagerGroup, len(t.errorHandlers.keys))
+	for i, key := range t.errorHandlers.keys {
+		result[i] = ErrorManagerGroup{key, t.errorHandlers.priorities[key], t.errorHandlers.managers[key]}
+	}
+	return result
+}
+
 // GetBuiltins returns the sorted list of builtin functions name added to the template.
 func (t *Template) GetBuiltins() []string { return getSortedName(t.GetBuiltinsMap()) }
 
@@ -55,6 +100,28 @@ func (t *Template) GetFuncs() []string { return getSortedName(t.GetFuncsMap()) }
 // GetFuncsMap returns the list of function added to the template.
 func (t *Template) GetFuncsMap() FuncMap { return t.parseFuncs }
 
+// GetParams returns the names of the parameters declared by the template through
+// {{define "name" param param=default}} or {{block "name" param=value}}.
+func (t *Template) GetParams() []string {
+	if t.Tree == nil {
+		return nil
+	}
+	result := make([]string, len(t.Params))
+	for i, param := range t.Params {
+		result[i] = param.Name
+	}
+	return result
+}
+
+func (t *Template) hasParam(name string) bool {
+	for _, param := range t.GetParams() {
+		if param == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ExtraFuncs allows registering of non standard functions, i.e. functions with no return,
 // or that returns multiple values.
 //
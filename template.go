@@ -109,7 +109,7 @@ func (t *Template) Clone() (*Template, error) {
 		nt.execFuncs[k] = v
 	}
 	for k, v := range t.errorHandlers.managers {
-		nt.ErrorManagers(k, v...)
+		nt.ErrorManagersPriority(k, t.errorHandlers.priorities[k], v...)
 	}
 	return nt, nil
 }
@@ -2,6 +2,7 @@ package template
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"reflect"
 )
@@ -25,6 +26,7 @@ func (t *Template) MissingMode() MissingAction { return t.option.missingKey.conv
 //   template.Option(template.NonStandardResults)
 //   template.Option(template.Trap)
 //   template.Option(template.Eval)
+//   template.Option(template.DynamicScope)
 //
 // Many options can be specified at once:
 //   template.Option(tenplate.ZeroValue, template.Trap, template.Eval)
@@ -32,6 +34,21 @@ func (t *Template) MissingMode() MissingAction { return t.option.missingKey.conv
 //   template.Option(tenplate.ZeroValue, template.Trap | template.Eval)
 //   // It is also possible to enable all extended features at once
 //   template.Option(tenplate.Default, template.AllOptions)
+//
+// Execution budgets are set by providing Limits:
+//   template.Option(template.Limits{MaxSteps: 10000, MaxIterations: 1000})
+//
+// Accessible fields, methods and functions are restricted by providing a Sandbox:
+//   template.Option(template.NewSandbox().AllowTypes(MyData{}))
+//
+// Execution can continue after errors by providing CollectErrors:
+//   template.Option(template.CollectErrors{Placeholder: "#ERROR"})
+//
+// Execution events are reported by providing a Tracer:
+//   template.Option(template.NewProfiler())
+//
+// Execution can be paused and inspected by providing a Debugger:
+//   template.Option(template.NewDebugger(hook).Break("name", 12))
 func (t *Template) Option(options ...interface{}) *Template {
 	t.init()
 	for _, opt := range options {
@@ -42,6 +59,16 @@ func (t *Template) Option(options ...interface{}) *Template {
 			t.option.missingKey = opt.convert()
 		case Option:
 			t.setTemplateOption(opt)
+		case Limits:
+			t.option.limits = opt
+		case *Sandbox:
+			t.option.sandbox = opt
+		case CollectErrors:
+			t.option.collect = &opt
+		case *Debugger:
+			t.option.debugger = opt
+		case Tracer:
+			t.option.tracer = opt
 		}
 	}
 	return t
@@ -80,6 +107,8 @@ const (
 	//
 	// {{ if not trap custom_func }}
 	// {{ end }}
+	//
+	// It also enables the {{ try }} ... {{ catch $err }} ... {{ end }} block that catches the errors of a whole section.
 	Trap
 
 	// Eval option add the function 'eval' to the template available functions. Using that function,
@@ -91,11 +120,21 @@ const (
 	Eval
 
 	// FlowControl option enables functions to control the execution flow within the template:
-	//   {{ break }}    is used within range block to quit the loop
-	//   {{ continue }} is used within range block to skip the rest of the block and go to next element
-	//   {{ return }}   is used to quit the current template
+	//   {{ return }}   is used to quit the current template, optionally supplying a value to its caller
+	//   {{ include "name" . }} executes a template and returns the value it supplied to return or its output
+	// The value returned by a template invoked through {{ template }} is printed in place of the invocation,
+	// while {{ $v := include "calc" .Data }} allows templates to be used as functions.
+	// Note that {{ break }} and {{ continue }} are keywords available within range blocks without this option.
 	FlowControl
 
+	// DynamicScope option lets invoked templates read the variables of their callers. The parameters declared
+	// by a template that receive no named argument take the value of the caller's variable with the same name:
+	//   {{ define "header" locale }}{{ $locale }}{{ end }}
+	//   {{ $locale := "fr" }}{{ template "header" . }}
+	// Callees get a copy of the values, assigning a parameter never changes the caller's variable.
+	// Dynamic scoping can also be enabled for a single execution with WithDynamicScope.
+	DynamicScope
+
 	// NonStandardResults enables functions and methods to have no return or more than one returned values.
 	// Note that this is simply an alias to FunctionsWithContext and that it is automatically enabled when
 	// registering non standard functions with ExtraFuncs method. However, it is required to activate that
@@ -115,17 +154,28 @@ const (
 	CallFailID = "^2_CallFailHandler"
 )
 
+const (
+	// FuncsAsMethodsPriority is the priority of the FunctionsAsMethods handler.
+	FuncsAsMethodsPriority = -300
+	// ContextPriority is the priority of the FunctionsWithContext handler.
+	ContextPriority = -200
+	// CallFailPriority is the priority of the trap handler.
+	CallFailPriority = -100
+	// DefaultPriority is the priority of error managers registered with ErrorManagers.
+	DefaultPriority = 0
+)
+
 func (t *Template) setTemplateOption(opt Option) {
 	if opt&FunctionsAsMethods != 0 {
-		t.ErrorManagers(FuncsAsMethodsID, functionsAsMethods)
+		t.ErrorManagersPriority(FuncsAsMethodsID, FuncsAsMethodsPriority, functionsAsMethods)
 	}
 
 	if opt&FunctionsWithContext != 0 {
-		t.ErrorManagers(ContextID, contextManagers...)
+		t.ErrorManagersPriority(ContextID, ContextPriority, contextManagers...)
 	}
 
 	if opt&Trap != 0 {
-		t.ErrorManagers(CallFailID, callFailManager).Funcs(FuncMap{
+		t.ErrorManagersPriority(CallFailID, CallFailPriority, callFailManager).Funcs(FuncMap{
 			"trap": func(context *Context) interface{} {
 				defer context.Recover()
 				args := context.EvalArgs()
@@ -156,13 +206,17 @@ func (t *Template) setTemplateOption(opt Option) {
 
 				var init string
 				for key, value := range context.Variables() {
+					if key == loopVariable && isImplicitLoop(value.(reflect.Value)) {
+						// Redeclaring the $loop of the range would shadow the ones of the evaluated ranges.
+						continue
+					}
 					data[key] = value
 					init += fmt.Sprintf(`{{- %[1]s := index $ "%[1]s" -}}`, key)
 				}
 				for _, expr := range expressions {
 					var buffer bytes.Buffer
 					if t, err = t.Parse(init + expr); err == nil {
-						err = t.Execute(&buffer, data)
+						err = t.executeWith(context.Context(), &buffer, data, context.state.budget, nil, context.state.depth+1)
 					}
 					if err != nil {
 						return result, err
@@ -174,11 +228,14 @@ func (t *Template) setTemplateOption(opt Option) {
 		})
 	}
 
+	if opt&DynamicScope != 0 {
+		t.option.dynamicScope = true
+	}
+
 	if opt&FlowControl != 0 {
 		t.Funcs(FuncMap{
-			"break":    func() string { panic(fcBreak) },
-			"continue": func() string { panic(fcContinue) },
-			"return":   flowReturnValues,
+			"include": flowInclude,
+			"return":  flowReturnValues,
 		})
 	}
 }
@@ -187,40 +244,34 @@ var (
 	functionsAsMethods = NewErrorManager(func(context *Context) (result interface{}, action ErrorAction) {
 		defer context.Recover()
 		var invoked bool
-		if result, invoked = context.TryCall(context.Match("function")); invoked {
+		if result, invoked = context.TryCall(context.MemberName()); invoked {
 			action = ResultReplaced
 		}
 		return
-	}).Filters(`can't evaluate field (?P<function>.*) in type (?P<receiver>.*)`)
+	}).OnErrors(ErrUnknownField)
 
 	contextManagers = ErrorManagers{
 		NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
 			return context.Call(nil), ResultReplaced
-		},
-			`can't call method/function "(?P<function>.*)" with (?P<result>\d+) result`).
-			OnSources(CallError),
+		}).OnErrors(ErrBadResults).OnSources(CallError),
 		NewErrorManager(func(context *Context) (result interface{}, action ErrorAction) {
 			defer context.Recover()
 			if ft := context.fun.Type(); ft.NumIn() > 0 && ft.In(0) == reflect.TypeOf(context) {
 				return context.Call(nil), ResultReplaced
 			}
 			return
-		},
-			`wrong number of args for (?P<function>.*): want (?P<want>\d+) got (?P<got>\d+)`,
-			`can't handle .* for arg of type \*template\.Context`,
-			`wrong type for value; expected \*template.Context; got .*`).
-			OnSources(CallError)}
+		}).OnErrors(ErrWrongArgCount, ErrWrongType).OnSources(CallError)}
 
 	callFailManager = NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
 		if context.Trapped() {
 			err := context.Error()
+			var execError ExecError
+			if errors.As(err, &execError) {
+				err = execError.Cause
+			}
 			context.ClearError()
 			return err, ResultReplaced
 		}
 		return nil, NoReplace
-	},
-		"executing \"(?P<template>.*)\" at <(?P<function>.*)>: error calling .*: (?P<error>.*)",
-		"executing \"(?P<template>.*)\" at <(?P<function>.*)>: (?P<error>.*)",
-		`(?P<error>.+)`,
-	).OnSources(CallError)
+	}).OnErrors(ErrCallFailed).OnSources(CallError)
 )
@@ -0,0 +1,156 @@
+package template
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/jocgir/template/parse"
+)
+
+// Tracer receives the events produced while executing a template.
+// A Tracer can be attached to a template through the Option method:
+//   template.New("name").Option(template.NewProfiler())
+// or to a single execution through the context supplied to ExecuteContext:
+//   t.ExecuteContext(template.WithTracer(ctx, tracer), wr, data)
+//
+// The same Tracer may receive events from parallel executions.
+type Tracer interface {
+	// TraceNode is called for every node visited while walking a template.
+	TraceNode(t *Template, node parse.Node)
+	// TraceCall is called after every function or method invocation.
+	TraceCall(t *Template, call CallTrace)
+	// TraceEnter is called when a template starts its execution, either directly or through {{template}}.
+	TraceEnter(t *Template)
+	// TraceExit is called when a template ends its execution.
+	TraceExit(t *Template, duration time.Duration, err error)
+	// TraceRecover is called when an error manager registered under id replaced a result.
+	TraceRecover(context *Context, id string, action ErrorAction)
+}
+
+// CallTrace describes a function or method invocation.
+type CallTrace struct {
+	Name     string          // Name of the function or method.
+	Node     parse.Node      // Node that triggered the call.
+	Args     []reflect.Value // Arguments supplied to the function, nil for functions using *Context.
+	Duration time.Duration   // Time spent in the function.
+	Err      error           // Error returned by the function, if any.
+}
+
+type tracerKey struct{}
+
+// WithTracer returns a copy of ctx that attaches tracer to the executions using it.
+// It takes precedence over the Tracer set on the template.
+func WithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// tracer returns the tracer used to execute t.
+func (t *Template) tracer(ctx context.Context) Tracer {
+	if tracer, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+		return tracer
+	}
+	if t.common == nil {
+		return nil
+	}
+	return t.option.tracer
+}
+
+// now returns the current time if the execution is traced.
+func (s *state) now() time.Time {
+	if s.tracer == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (s *state) traceNode(node parse.Node) {
+	if s.tracer != nil {
+		s.tracer.TraceNode(s.tmpl, node)
+	}
+}
+
+func (s *state) traceCall(name string, node parse.Node, args []reflect.Value, start time.Time, err error) {
+	if s.tracer != nil {
+		s.tracer.TraceCall(s.tmpl, CallTrace{name, node, args, time.Since(start), err})
+	}
+}
+
+// traceCallPanic is deferred to trace a call that reports its errors by panicking.
+func (s *state) traceCallPanic(name string, node parse.Node, start time.Time) {
+	rec := recover()
+	s.traceCall(name, node, nil, start, traceError(rec))
+	if rec != nil {
+		panic(rec)
+	}
+}
+
+// traceEnter notifies the tracer that tmpl is entered. It returns the start time
+// that must be supplied to traceExit.
+func (s *state) traceEnter(tmpl *Template) time.Time {
+	if s.tracer != nil {
+		s.tracer.TraceEnter(tmpl)
+	}
+	return s.now()
+}
+
+// traceExit is deferred to notify the tracer that tmpl is exited.
+func (s *state) traceExit(tmpl *Template, start time.Time) {
+	rec := recover()
+	s.tracer.TraceExit(tmpl, time.Since(start), traceError(rec))
+	if rec != nil {
+		panic(rec)
+	}
+}
+
+func (s *state) traceRecover(context *Context, id string, action ErrorAction) {
+	if s.tracer != nil {
+		s.tracer.TraceRecover(context, id, action)
+	}
+}
+
+// traceError returns the error reported by a recovered panic, flow and loop controls are not errors.
+func traceError(rec interface{}) error {
+	switch rec := rec.(type) {
+	case flowControl, loopControl:
+		return nil
+	case writeError:
+		return rec.Err
+	}
+	return asError(rec)
+}
+
+// MultiTracer returns a Tracer that forwards the events to all tracers.
+func MultiTracer(tracers ...Tracer) Tracer { return multiTracer(tracers) }
+
+type multiTracer []Tracer
+
+func (m multiTracer) TraceNode(t *Template, node parse.Node) {
+	for _, tracer := range m {
+		tracer.TraceNode(t, node)
+	}
+}
+
+func (m multiTracer) TraceCall(t *Template, call CallTrace) {
+	for _, tracer := range m {
+		tracer.TraceCall(t, call)
+	}
+}
+
+func (m multiTracer) TraceEnter(t *Template) {
+	for _, tracer := range m {
+		tracer.TraceEnter(t)
+	}
+}
+
+func (m multiTracer) TraceExit(t *Template, duration time.Duration, err error) {
+	for _, tracer := range m {
+		tracer.TraceExit(t, duration, err)
+	}
+}
+
+func (m multiTracer) TraceRecover(context *Context, id string, action ErrorAction) {
+	for _, tracer := range m {
+		tracer.TraceRecover(context, id, action)
+	}
+}
@@ -0,0 +1,164 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jocgir/template/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a Tracer that records the events it receives.
+type recorder struct{ events []string }
+
+func (r *recorder) TraceNode(t *Template, node parse.Node) {
+	if node.Type() != parse.NodeList {
+		r.events = append(r.events, fmt.Sprintf("node %s %s", t.Name(), node))
+	}
+}
+
+func (r *recorder) TraceCall(t *Template, call CallTrace) {
+	r.events = append(r.events, fmt.Sprintf("call %s %s %d %v", t.Name(), call.Name, len(call.Args), call.Err))
+}
+
+func (r *recorder) TraceEnter(t *Template) {
+	r.events = append(r.events, "enter "+t.Name())
+}
+
+func (r *recorder) TraceExit(t *Template, _ time.Duration, err error) {
+	r.events = append(r.events, fmt.Sprintf("exit %s %v", t.Name(), err != nil))
+}
+
+func (r *recorder) TraceRecover(context *Context, id string, action ErrorAction) {
+	r.events = append(r.events, fmt.Sprintf("recover %s %s %s", context.MemberName(), id, action))
+}
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	funcs := FuncMap{
+		"add":  func(a, b int) int { return a + b },
+		"fail": func() (int, error) { return 0, errors.New("boom") },
+	}
+	tests := []struct {
+		name   string
+		input  string
+		data   interface{}
+		events []string
+		err    bool
+	}{
+		{
+			name:  "Text and call",
+			input: `a{{add 1 2}}`,
+			events: []string{
+				"enter t",
+				"node t a",
+				"node t {{add 1 2}}",
+				"call t add 2 <nil>",
+				"exit t false",
+			},
+		},
+		{
+			name:  "Nested template",
+			input: `{{define "x"}}{{.}}{{end}}{{template "x" 1}}`,
+			events: []string{
+				"enter t",
+				`node t {{template "x" 1}}`,
+				"enter x",
+				"node x {{.}}",
+				"exit x false",
+				"exit t false",
+			},
+		},
+		{
+			name:  "Failing call",
+			input: `{{fail}}`,
+			err:   true,
+			events: []string{
+				"enter t",
+				"node t {{fail}}",
+				"call t fail 0 boom",
+				"exit t true",
+			},
+		},
+		{
+			name:  "Error manager",
+			input: `{{.Missing}}`,
+			data:  1,
+			events: []string{
+				"enter t",
+				"node t {{.Missing}}",
+				"recover Missing test Replaced",
+				"exit t false",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tracer := new(recorder)
+			tmpl := Must(New("t").Funcs(funcs).ErrorManagers("test", NewErrorManager(func(context *Context) (interface{}, ErrorAction) {
+				context.ClearError()
+				return "x", ResultReplaced
+			}).OnMembers("Missing")).Option(tracer).Parse(tc.input))
+
+			err := tmpl.Execute(new(bytes.Buffer), tc.data)
+			assert.Equal(t, tc.err, err != nil, "%v", err)
+			assert.Equal(t, tc.events, tracer.events)
+		})
+	}
+}
+
+func TestTracerFromContext(t *testing.T) {
+	t.Parallel()
+
+	onTemplate, onContext := new(recorder), new(recorder)
+	tmpl := Must(New("t").Option(onTemplate).Parse(`{{.}}`))
+	assert.NoError(t, tmpl.ExecuteContext(WithTracer(context.Background(), onContext), new(bytes.Buffer), 1))
+	assert.Empty(t, onTemplate.events)
+	assert.Equal(t, []string{"enter t", "node t {{.}}", "exit t false"}, onContext.events)
+}
+
+func TestProfiler(t *testing.T) {
+	t.Parallel()
+
+	profiler := NewProfiler()
+	tmpl := Must(New("t").Funcs(FuncMap{
+		"sleep": func() string { time.Sleep(time.Millisecond); return "" },
+	}).Option(profiler).Parse(`{{define "x"}}{{sleep}}{{end}}{{range .}}{{template "x"}}{{end}}{{len .}}`))
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, tmpl.Execute(new(bytes.Buffer), []int{1, 2, 3}))
+	}
+
+	templates := profiler.Templates()
+	if assert.Len(t, templates, 2) {
+		assert.Equal(t, "t", templates[0].Name)
+		assert.Equal(t, 2, templates[0].Count)
+		assert.Equal(t, "x", templates[1].Name)
+		assert.Equal(t, 6, templates[1].Count)
+		assert.True(t, templates[0].Total >= templates[1].Total)
+	}
+	functions := profiler.Functions()
+	if assert.Len(t, functions, 2) {
+		assert.Equal(t, "sleep", functions[0].Name)
+		assert.Equal(t, 6, functions[0].Count)
+		assert.True(t, functions[0].Average() >= time.Millisecond)
+		assert.True(t, functions[0].Max >= functions[0].Average())
+		assert.Equal(t, "len", functions[1].Name)
+	}
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, profiler.WriteReport(buffer))
+	assert.Len(t, strings.Split(strings.TrimSpace(buffer.String()), "\n"), 5)
+
+	profiler.Reset()
+	assert.Empty(t, profiler.Templates())
+}